@@ -0,0 +1,62 @@
+package bffmethod
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/google/martian/v3/log"
+)
+
+// Matcher is a conditional evaluator of request methods to be used in filters
+// that take conditionals.
+type Matcher struct {
+	methods []string
+}
+
+// NewMatcher builds a matcher of the given methods, it matches every method
+// when there are none.
+func NewMatcher(methods ...string) *Matcher {
+	m := &Matcher{}
+
+	for _, method := range methods {
+		m.methods = append(m.methods, strings.ToUpper(method))
+	}
+
+	return m
+}
+
+// Methods returns the methods matched by m, none when it matches every method.
+func (m *Matcher) Methods() []string {
+	return m.methods
+}
+
+// MatchRequest returns true if the request method is one of m.methods.
+func (m *Matcher) MatchRequest(req *http.Request) bool {
+	matched := m.matches(req.Method)
+
+	if matched {
+		log.Debugf("bffmethod.Matcher.MatchRequest: matched: %s", req.Method)
+	}
+
+	return matched
+}
+
+// MatchResponse returns true if the method of the request of the response is
+// one of m.methods.
+func (m *Matcher) MatchResponse(res *http.Response) bool {
+	return m.matches(res.Request.Method)
+}
+
+func (m *Matcher) matches(method string) bool {
+	if len(m.methods) == 0 {
+		return true
+	}
+
+	for _, want := range m.methods {
+		if want == method {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,238 @@
+package bffparse
+
+import (
+	"encoding/json"
+
+	"github.com/google/martian/v3"
+	"github.com/google/martian/v3/parse"
+
+	// the placeholder of the stripped nested entries
+	_ "github.com/google/martian/v3/noop"
+)
+
+// placeholder stands in for a nested entry while martian parses the entry
+// holding it.
+var placeholder = json.RawMessage(`{"noop.Modifier": {"scope": ["request", "response"]}}`)
+
+// the registered modifiers holding nested entries. martian's groups and
+// filters parse theirs with parse.FromJSON, they are parsed again here with the
+// fields holding them. bff's parse theirs with FromJSON, or fetch them in their
+// own spans, and are left alone.
+var (
+	groups  = map[string]bool{"fifo.Group": true, "priority.Group": true}
+	filters = map[string][]string{
+		"cookie.Filter":      {"modifier", "else"},
+		"header.Filter":      {"modifier", "else"},
+		"header.RegexFilter": {"modifier"},
+		"method.Filter":      {"modifier", "else"},
+		"port.Filter":        {"modifier"},
+		"querystring.Filter": {"modifier", "else"},
+		"url.Filter":         {"modifier", "else"},
+		"url.RegexFilter":    {"modifier", "else"},
+	}
+	selfParsed = map[string]bool{
+		"bff.Routes":        true,
+		"bff.URLFilter":     true,
+		"body.JSONResource": true,
+		"body.MultiFetcher": true,
+		"status.Filter":     true,
+	}
+)
+
+// Composite returns whether name is a modifier known to hold nested entries,
+// the entries nested in the ones that are not known miss their spans and the
+// path of their errors.
+func Composite(name string) bool {
+	_, filter := filters[name]
+
+	return groups[name] || filter || selfParsed[name]
+}
+
+// conditional is a martian filter.Filter.
+type conditional interface {
+	RequestWhenTrue(martian.RequestModifier)
+	ResponseWhenTrue(martian.ResponseModifier)
+	RequestWhenFalse(martian.RequestModifier)
+	ResponseWhenFalse(martian.ResponseModifier)
+}
+
+// unconditional is a martian filter without an else modifier.
+type unconditional interface {
+	SetRequestModifier(martian.RequestModifier)
+	SetResponseModifier(martian.ResponseModifier)
+}
+
+// fifoGroup is a martian fifo.Group.
+type fifoGroup interface {
+	AddRequestModifier(martian.RequestModifier)
+	AddResponseModifier(martian.ResponseModifier)
+}
+
+// priorityGroup is a martian priority.Group.
+type priorityGroup interface {
+	AddRequestModifier(martian.RequestModifier, int64)
+	AddResponseModifier(martian.ResponseModifier, int64)
+}
+
+type priorityJSON struct {
+	Priority int64           `json:"priority"`
+	Modifier json.RawMessage `json:"modifier"`
+}
+
+// Parse parses a modifier entry like parse.FromJSON. The entries nested in
+// martian's groups and filters are parsed with FromJSON, like the ones nested
+// in bff's modifiers, so that their errors are tagged and their spans are
+// recorded.
+func Parse(raw []byte) (*parse.Result, error) {
+	var msg map[string]map[string]json.RawMessage
+
+	if err := json.Unmarshal(raw, &msg); err != nil || len(msg) != 1 {
+		return parse.FromJSON(raw)
+	}
+
+	for name, fields := range msg {
+		if groups[name] {
+			return parseGroup(name, fields)
+		}
+
+		if keys, ok := filters[name]; ok {
+			return parseFilter(name, fields, keys)
+		}
+	}
+
+	return parse.FromJSON(raw)
+}
+
+// strip parses an entry with its nested entries stripped, martian reports the
+// errors of its own fields.
+func strip(name string, fields map[string]json.RawMessage) (*parse.Result, error) {
+	raw, err := json.Marshal(map[string]interface{}{name: fields})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return parse.FromJSON(raw)
+}
+
+// modifierOf returns the modifier of a parse result, whichever its scope.
+func modifierOf(r *parse.Result) interface{} {
+	if reqmod := r.RequestModifier(); reqmod != nil {
+		return reqmod
+	}
+
+	return r.ResponseModifier()
+}
+
+func parseGroup(name string, fields map[string]json.RawMessage) (*parse.Result, error) {
+	nested := fields["modifiers"]
+	fields["modifiers"] = json.RawMessage("[]")
+
+	r, err := strip(name, fields)
+
+	if err != nil || len(nested) == 0 {
+		return r, err
+	}
+
+	switch g := modifierOf(r).(type) {
+	case fifoGroup:
+		var entries []json.RawMessage
+
+		if err := json.Unmarshal(nested, &entries); err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			m, err := FromJSON(entry)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if reqmod := m.RequestModifier(); reqmod != nil {
+				g.AddRequestModifier(reqmod)
+			}
+
+			if resmod := m.ResponseModifier(); resmod != nil {
+				g.AddResponseModifier(resmod)
+			}
+		}
+	case priorityGroup:
+		var entries []priorityJSON
+
+		if err := json.Unmarshal(nested, &entries); err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			m, err := FromJSON(entry.Modifier)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if reqmod := m.RequestModifier(); reqmod != nil {
+				g.AddRequestModifier(reqmod, entry.Priority)
+			}
+
+			if resmod := m.ResponseModifier(); resmod != nil {
+				g.AddResponseModifier(resmod, entry.Priority)
+			}
+		}
+	}
+
+	return r, nil
+}
+
+func parseFilter(name string, fields map[string]json.RawMessage, keys []string) (*parse.Result, error) {
+	nested := make(map[string]json.RawMessage)
+
+	for _, key := range keys {
+		if entry, ok := fields[key]; ok && len(entry) > 0 && string(entry) != "null" {
+			nested[key] = entry
+			fields[key] = placeholder
+		}
+	}
+
+	r, err := strip(name, fields)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		entry, ok := nested[key]
+
+		if !ok {
+			continue
+		}
+
+		m, err := FromJSON(entry)
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch f := modifierOf(r).(type) {
+		case conditional:
+			if key == "else" {
+				f.RequestWhenFalse(m.RequestModifier())
+				f.ResponseWhenFalse(m.ResponseModifier())
+			} else {
+				f.RequestWhenTrue(m.RequestModifier())
+				f.ResponseWhenTrue(m.ResponseModifier())
+			}
+		case unconditional:
+			// martian only sets the modifiers of the entry's scope
+			if reqmod := m.RequestModifier(); reqmod != nil {
+				f.SetRequestModifier(reqmod)
+			}
+
+			if resmod := m.ResponseModifier(); resmod != nil {
+				f.SetResponseModifier(resmod)
+			}
+		}
+	}
+
+	return r, nil
+}
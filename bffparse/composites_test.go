@@ -0,0 +1,196 @@
+package bffparse
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/google/martian/v3"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	_ "github.com/google/martian/v3/fifo"
+	_ "github.com/google/martian/v3/header"
+	_ "github.com/google/martian/v3/port"
+	_ "github.com/google/martian/v3/priority"
+)
+
+func TestParseNestedEntries(t *testing.T) {
+	r, err := Parse([]byte(`{
+	  "fifo.Group": {
+	    "scope": ["request"],
+	    "modifiers": [
+	      {
+	        "header.Filter": {
+	          "scope": ["request"],
+	          "name": "X-Match",
+	          "value": "yes",
+	          "modifier": {"header.Modifier": {"scope": ["request"], "name": "X-Then", "value": "true"}},
+	          "else": {"header.Modifier": {"scope": ["request"], "name": "X-Else", "value": "true"}}
+	        }
+	      },
+	      {
+	        "priority.Group": {
+	          "scope": ["request"],
+	          "modifiers": [
+	            {"priority": 0, "modifier": {"header.Modifier": {"scope": ["request"], "name": "X-Order", "value": "last"}}},
+	            {"priority": 10, "modifier": {"header.Modifier": {"scope": ["request"], "name": "X-Order", "value": "first"}}}
+	          ]
+	        }
+	      },
+	      {
+	        "port.Filter": {
+	          "scope": ["request"],
+	          "port": 80,
+	          "modifier": {"header.Modifier": {"scope": ["request"], "name": "X-Port", "value": "80"}}
+	        }
+	      }
+	    ]
+	  }
+	}`))
+	if err != nil {
+		t.Fatalf("Parse(): got %v, want no error", err)
+	}
+
+	tt := []struct {
+		match string
+		want  map[string]string
+	}{
+		{match: "yes", want: map[string]string{"X-Then": "true", "X-Else": "", "X-Order": "last", "X-Port": "80"}},
+		{match: "no", want: map[string]string{"X-Then": "", "X-Else": "true", "X-Order": "last", "X-Port": "80"}},
+	}
+
+	for i, tc := range tt {
+		req, err := http.NewRequest("GET", "http://example.com", nil)
+		if err != nil {
+			t.Fatalf("%d. http.NewRequest(): got %v, want no error", i, err)
+		}
+		req.Header.Set("X-Match", tc.match)
+
+		_, remove, err := martian.TestContext(req, nil, nil)
+		if err != nil {
+			t.Fatalf("%d. martian.TestContext(): got %v, want no error", i, err)
+		}
+
+		if err := r.RequestModifier().ModifyRequest(req); err != nil {
+			t.Fatalf("%d. ModifyRequest(): got %v, want no error", i, err)
+		}
+
+		for name, want := range tc.want {
+			if got := req.Header.Get(name); got != want {
+				t.Errorf("%d. req.Header.Get(%q): got %q, want %q", i, name, got, want)
+			}
+		}
+
+		remove()
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tt := []string{
+		// a nested entry fails to parse
+		`{"fifo.Group": {"scope": ["request"], "modifiers": [{"unknown.Modifier": {}}]}}`,
+		`{"header.Filter": {"scope": ["request"], "name": "X-Match", "value": "yes", "modifier": {"unknown.Modifier": {}}}}`,
+		`{"priority.Group": {"scope": ["request"], "modifiers": [{"priority": 0, "modifier": {"unknown.Modifier": {}}}]}}`,
+		// martian still reports the errors of the entry
+		`{"header.Filter": {"scope": ["request"], "name": "X-Match", "value": "yes"}}`,
+		`{"header.RegexFilter": {"scope": ["request"], "header": "X-Match", "regex": "(", "modifier": {"header.Modifier": {"scope": ["request"], "name": "X", "value": "y"}}}}`,
+	}
+
+	for i, raw := range tt {
+		if _, err := Parse([]byte(raw)); err == nil {
+			t.Errorf("%d. Parse(%s): got no error, want error", i, raw)
+		}
+	}
+}
+
+func TestFromJSONTracesNestedEntries(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(prev)
+
+	r, err := FromJSON([]byte(`{
+	  "fifo.Group": {
+	    "scope": ["request"],
+	    "modifiers": [
+	      {
+	        "header.Filter": {
+	          "scope": ["request"],
+	          "name": "X-Match",
+	          "value": "yes",
+	          "modifier": {"failure.Verifier": {"scope": ["request"], "message": "boom"}}
+	        }
+	      }
+	    ]
+	  }
+	}`))
+	if err != nil {
+		t.Fatalf("FromJSON(): got %v, want no error", err)
+	}
+
+	req, err := http.NewRequest("GET", "http://example.com", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest(): got %v, want no error", err)
+	}
+	req.Header.Set("X-Match", "yes")
+
+	_, remove, err := martian.TestContext(req, nil, nil)
+	if err != nil {
+		t.Fatalf("martian.TestContext(): got %v, want no error", err)
+	}
+	defer remove()
+
+	reqmod := r.RequestModifier()
+	if err := reqmod.ModifyRequest(req); err != nil {
+		t.Fatalf("ModifyRequest(): got %v, want no error", err)
+	}
+
+	spans := sr.Ended()
+	names := make([]string, len(spans))
+
+	for i, span := range spans {
+		names[i] = span.Name()
+	}
+
+	// inner spans end first
+	if want := []string{"failure.Verifier request", "header.Filter request", "fifo.Group request"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("spans: got %v, want %v", names, want)
+	}
+
+	for i := 0; i < len(spans)-1; i++ {
+		if got, want := spans[i].Parent().SpanID(), spans[i+1].SpanContext().SpanID(); got != want {
+			t.Errorf("%s: got parent %s, want %s", names[i], got, want)
+		}
+	}
+
+	err = reqmod.(interface{ VerifyRequests() error }).VerifyRequests()
+
+	var failure *ModifierFailure
+	if !errors.As(unwrapFirst(err), &failure) {
+		t.Fatalf("VerifyRequests(): got %v, want *ModifierFailure", err)
+	}
+	if got, want := failure.Modifier, "failure.Verifier"; got != want {
+		t.Errorf("failure.Modifier: got %q, want %q", got, want)
+	}
+	if got, want := failure.Path, []string{"fifo.Group", "header.Filter"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("failure.Path: got %v, want %v", got, want)
+	}
+}
+
+// unwrapFirst returns the first error of nested martian.MultiErrors.
+func unwrapFirst(err error) error {
+	for {
+		merr, ok := err.(*martian.MultiError)
+
+		if !ok || len(merr.Errors()) == 0 {
+			return err
+		}
+
+		err = merr.Errors()[0]
+	}
+}
@@ -0,0 +1,227 @@
+// Package bffparse parses modifiers that tag their errors and spans with the
+// name of the modifier entry they were configured under.
+package bffparse
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/google/martian/v3"
+	"github.com/google/martian/v3/parse"
+	"github.com/google/martian/v3/verify"
+	"github.com/imranismail/bff/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ModifierFailure is an error returned by a configured modifier, it records
+// the name of the innermost modifier entry that returned it and the names of
+// the entries it is nested in, outermost first.
+type ModifierFailure struct {
+	Modifier string
+	Path     []string
+	Err      error
+}
+
+func (e *ModifierFailure) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ModifierFailure) Unwrap() error {
+	return e.Err
+}
+
+// Within returns whether name is the modifier that failed or one it is nested
+// in.
+func (e *ModifierFailure) Within(name string) bool {
+	if e.Modifier == name {
+		return true
+	}
+
+	for _, outer := range e.Path {
+		if outer == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FromJSON parses a modifier entry like Parse, its errors are tagged with the
+// name of the entry and it runs in its own span.
+func FromJSON(raw []byte) (*parse.Result, error) {
+	r, err := Parse(raw)
+
+	if err != nil || r == nil {
+		return r, err
+	}
+
+	name := Name(raw)
+	named := &namedModifier{}
+	scope := []parse.ModifierType{}
+
+	if reqmod := r.RequestModifier(); reqmod != nil {
+		named.RequestModifier = NewRequestModifier(name, reqmod)
+		scope = append(scope, parse.Request)
+	}
+
+	if resmod := r.ResponseModifier(); resmod != nil {
+		named.ResponseModifier = NewResponseModifier(name, resmod)
+		scope = append(scope, parse.Response)
+	}
+
+	return parse.NewResult(named, scope)
+}
+
+// Name returns the registered name(s) a modifier entry refers to.
+func Name(raw []byte) string {
+	var msg map[string]json.RawMessage
+
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return "<invalid>"
+	}
+
+	names := make([]string, 0, len(msg))
+
+	for name := range msg {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return strings.Join(names, ",")
+}
+
+// TagErrors wraps every error nested in err in a *ModifierFailure of name.
+// Errors already tagged by an inner modifier keep its name and record name as
+// the entry they are nested in.
+func TagErrors(name string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if merr, ok := err.(*martian.MultiError); ok {
+		tagged := martian.NewMultiError()
+
+		for _, err := range merr.Errors() {
+			tagged.Add(TagErrors(name, err))
+		}
+
+		return tagged
+	}
+
+	if failure, ok := err.(*ModifierFailure); ok {
+		return &ModifierFailure{
+			Modifier: failure.Modifier,
+			Path:     append([]string{name}, failure.Path...),
+			Err:      failure.Err,
+		}
+	}
+
+	var failure *ModifierFailure
+
+	if errors.As(err, &failure) {
+		return err
+	}
+
+	return &ModifierFailure{Modifier: name, Err: err}
+}
+
+// startSpan starts the span of a modifier as the current span of the request,
+// the returned func ends it and restores the previous current span.
+func startSpan(ctx *martian.Context, name string) (trace.Span, func()) {
+	parent := tracing.Context(ctx)
+	c, span := tracing.Start(parent, name, trace.SpanKindInternal)
+
+	tracing.SetContext(ctx, c)
+
+	return span, func() {
+		span.End()
+		tracing.SetContext(ctx, parent)
+	}
+}
+
+// namedModifier holds the named request and response modifiers of an entry
+// parsed by FromJSON, only the ones of its scope are set.
+type namedModifier struct {
+	*RequestModifier
+	*ResponseModifier
+}
+
+// RequestModifier tags the errors of a request modifier and verifier.
+type RequestModifier struct {
+	name   string
+	reqmod martian.RequestModifier
+}
+
+// NewRequestModifier returns a RequestModifier of reqmod configured as name.
+func NewRequestModifier(name string, reqmod martian.RequestModifier) *RequestModifier {
+	return &RequestModifier{name: name, reqmod: reqmod}
+}
+
+// ModifyRequest runs the modifier in its own span and tags its errors.
+func (m *RequestModifier) ModifyRequest(req *http.Request) error {
+	span, end := startSpan(martian.NewContext(req), m.name+" request")
+	defer end()
+
+	err := m.reqmod.ModifyRequest(req)
+	tracing.SetError(span, err)
+
+	return TagErrors(m.name, err)
+}
+
+// VerifyRequests tags the errors of the verifier.
+func (m *RequestModifier) VerifyRequests() error {
+	if reqv, ok := m.reqmod.(verify.RequestVerifier); ok {
+		return TagErrors(m.name, reqv.VerifyRequests())
+	}
+
+	return nil
+}
+
+// ResetRequestVerifications resets the verifier.
+func (m *RequestModifier) ResetRequestVerifications() {
+	if reqv, ok := m.reqmod.(verify.RequestVerifier); ok {
+		reqv.ResetRequestVerifications()
+	}
+}
+
+// ResponseModifier tags the errors of a response modifier and verifier.
+type ResponseModifier struct {
+	name   string
+	resmod martian.ResponseModifier
+}
+
+// NewResponseModifier returns a ResponseModifier of resmod configured as name.
+func NewResponseModifier(name string, resmod martian.ResponseModifier) *ResponseModifier {
+	return &ResponseModifier{name: name, resmod: resmod}
+}
+
+// ModifyResponse runs the modifier in its own span and tags its errors.
+func (m *ResponseModifier) ModifyResponse(res *http.Response) error {
+	span, end := startSpan(martian.NewContext(res.Request), m.name+" response")
+	defer end()
+
+	err := m.resmod.ModifyResponse(res)
+	tracing.SetError(span, err)
+
+	return TagErrors(m.name, err)
+}
+
+// VerifyResponses tags the errors of the verifier.
+func (m *ResponseModifier) VerifyResponses() error {
+	if resv, ok := m.resmod.(verify.ResponseVerifier); ok {
+		return TagErrors(m.name, resv.VerifyResponses())
+	}
+
+	return nil
+}
+
+// ResetResponseVerifications resets the verifier.
+func (m *ResponseModifier) ResetResponseVerifications() {
+	if resv, ok := m.resmod.(verify.ResponseVerifier); ok {
+		resv.ResetResponseVerifications()
+	}
+}
@@ -0,0 +1,97 @@
+package bffparse
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/google/martian/v3"
+
+	_ "github.com/google/martian/v3/failure"
+)
+
+func TestTagErrors(t *testing.T) {
+	base := errors.New("verify failure")
+
+	inner := TagErrors("bff.URLVerifier", base)
+	outer := TagErrors("bff.Routes", TagErrors("bff.URLFilter", inner))
+
+	var failure *ModifierFailure
+	if !errors.As(outer, &failure) {
+		t.Fatalf("errors.As(): got %T, want *ModifierFailure", outer)
+	}
+	if got, want := failure.Modifier, "bff.URLVerifier"; got != want {
+		t.Errorf("failure.Modifier: got %q, want %q", got, want)
+	}
+	if got, want := failure.Path, []string{"bff.Routes", "bff.URLFilter"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("failure.Path: got %v, want %v", got, want)
+	}
+	if !errors.Is(outer, base) {
+		t.Errorf("errors.Is(): got false, want the original error")
+	}
+
+	for _, name := range []string{"bff.URLVerifier", "bff.URLFilter", "bff.Routes"} {
+		if !failure.Within(name) {
+			t.Errorf("failure.Within(%q): got false, want true", name)
+		}
+	}
+	if failure.Within("body.JSONResource") {
+		t.Errorf("failure.Within(body.JSONResource): got true, want false")
+	}
+
+	merr := martian.NewMultiError()
+	merr.Add(base)
+	merr.Add(inner)
+
+	tagged, ok := TagErrors("bff.Routes", merr).(*martian.MultiError)
+	if !ok {
+		t.Fatalf("TagErrors(MultiError): got %T, want *martian.MultiError", tagged)
+	}
+
+	for i, want := range []string{"bff.Routes", "bff.URLVerifier"} {
+		if !errors.As(tagged.Errors()[i], &failure) || failure.Modifier != want {
+			t.Errorf("%d. failure.Modifier: got %v, want %q", i, tagged.Errors()[i], want)
+		}
+	}
+}
+
+func TestFromJSONTagsErrors(t *testing.T) {
+	r, err := FromJSON([]byte(`{"failure.Verifier": {"scope": ["request"], "message": "boom"}}`))
+	if err != nil {
+		t.Fatalf("FromJSON(): got %v, want no error", err)
+	}
+	if r.ResponseModifier() != nil {
+		t.Errorf("r.ResponseModifier(): got %T, want nil", r.ResponseModifier())
+	}
+
+	req, err := http.NewRequest("GET", "http://example.com", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest(): got %v, want no error", err)
+	}
+
+	_, remove, err := martian.TestContext(req, nil, nil)
+	if err != nil {
+		t.Fatalf("martian.TestContext(): got %v, want no error", err)
+	}
+	defer remove()
+
+	reqmod := r.RequestModifier()
+	if err := reqmod.ModifyRequest(req); err != nil {
+		t.Fatalf("ModifyRequest(): got %v, want no error", err)
+	}
+
+	err = reqmod.(interface{ VerifyRequests() error }).VerifyRequests()
+
+	if merr, ok := err.(*martian.MultiError); ok && len(merr.Errors()) == 1 {
+		err = merr.Errors()[0]
+	}
+
+	var failure *ModifierFailure
+	if !errors.As(err, &failure) {
+		t.Fatalf("VerifyRequests(): got %v, want *ModifierFailure", err)
+	}
+	if got, want := failure.Modifier, "failure.Verifier"; got != want {
+		t.Errorf("failure.Modifier: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,448 @@
+// Package bffroute provides a route table matching requests on their method,
+// host and path.
+package bffroute
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/google/martian/v3"
+	"github.com/google/martian/v3/log"
+	"github.com/google/martian/v3/parse"
+	"github.com/google/martian/v3/verify"
+	"github.com/imranismail/bff/bffmethod"
+	"github.com/imranismail/bff/bffparse"
+	"github.com/imranismail/bff/bffurl"
+	"github.com/imranismail/bff/upstream"
+)
+
+func init() {
+	parse.Register("bff.Routes", routesFromJSON)
+}
+
+// Routes runs the modifiers of the most specific route matching a request and
+// of no other route. Requests matching no route run the else modifiers, or are
+// rejected with a 404 or 405 Error when the routes are strict.
+type Routes struct {
+	routes []*route
+	strict bool
+	reqmod martian.RequestModifier
+	resmod martian.ResponseModifier
+	ctxKey string
+}
+
+type route struct {
+	index    int
+	methods  *bffmethod.Matcher
+	url      *bffurl.Matcher
+	upstream *upstream.Modifier
+	reqmod   martian.RequestModifier
+	resmod   martian.ResponseModifier
+}
+
+type routesJSON struct {
+	Routes       []routeJSON          `json:"routes"`
+	Strict       bool                 `json:"strict"`
+	ElseModifier json.RawMessage      `json:"else"`
+	Scope        []parse.ModifierType `json:"scope"`
+}
+
+type routeJSON struct {
+	Methods  []string        `json:"methods"`
+	Host     string          `json:"host"`
+	Path     string          `json:"path"`
+	Upstream string          `json:"upstream"`
+	Modifier json.RawMessage `json:"modifier"`
+}
+
+// Error is the error of a request matching no route of strict routes, its
+// Status is 404, or 405 when a route matches its path but not its method.
+type Error struct {
+	Status int
+	Method string
+	Path   string
+	Allow  []string
+}
+
+func (e *Error) Error() string {
+	if e.Status == http.StatusMethodNotAllowed {
+		return fmt.Sprintf("bff.Routes: method %s not allowed for %s, allowed: %s", e.Method, e.Path, strings.Join(e.Allow, ", "))
+	}
+
+	return fmt.Sprintf("bff.Routes: no route for %s %s", e.Method, e.Path)
+}
+
+// Headers returns the headers of the error response, the Allow header of a 405.
+func (e *Error) Headers() http.Header {
+	h := http.Header{}
+
+	if len(e.Allow) > 0 {
+		h.Set("Allow", strings.Join(e.Allow, ", "))
+	}
+
+	return h
+}
+
+// NewRoutes returns an empty route table, unmatched requests are rejected when
+// strict is set.
+func NewRoutes(strict bool) *Routes {
+	r := &Routes{strict: strict}
+	r.ctxKey = fmt.Sprintf("bffroute.Routes.%p", r)
+
+	return r
+}
+
+// AddRoute adds a route matching the methods, none for every method, and the
+// host and path patterns of u. A nil upstream keeps the upstream of the
+// request, reqmod and resmod may be nil. It fails on an invalid host or path
+// pattern.
+func (r *Routes) AddRoute(methods []string, u *url.URL, up *url.URL, reqmod martian.RequestModifier, resmod martian.ResponseModifier) error {
+	m, err := bffurl.NewMatcher(u)
+
+	if err != nil {
+		return err
+	}
+
+	rt := &route{
+		index:   len(r.routes),
+		methods: bffmethod.NewMatcher(methods...),
+		url:     m,
+		reqmod:  reqmod,
+		resmod:  resmod,
+	}
+
+	if up != nil {
+		rt.upstream = upstream.NewModifier(up)
+	}
+
+	r.routes = append(r.routes, rt)
+
+	// the most specific route is tried first, ties keep the config order
+	sort.SliceStable(r.routes, func(i, j int) bool {
+		return r.routes[i].compare(r.routes[j]) > 0
+	})
+
+	return nil
+}
+
+// SetElse sets the modifiers of the requests matching no route.
+func (r *Routes) SetElse(reqmod martian.RequestModifier, resmod martian.ResponseModifier) {
+	r.reqmod = reqmod
+	r.resmod = resmod
+}
+
+// compare compares the specificity of rt and o, a route limited to some
+// methods beats one that is not when their patterns are as specific.
+func (rt *route) compare(o *route) int {
+	if d := rt.url.Compare(o.url); d != 0 {
+		return d
+	}
+
+	switch {
+	case len(rt.methods.Methods()) > 0 && len(o.methods.Methods()) == 0:
+		return 1
+	case len(rt.methods.Methods()) == 0 && len(o.methods.Methods()) > 0:
+		return -1
+	}
+
+	return 0
+}
+
+// match returns the route of req, or nil and the methods of the routes matching
+// its path but not its method.
+func (r *Routes) match(req *http.Request) (*route, []string) {
+	for _, rt := range r.routes {
+		if rt.methods.MatchRequest(req) && rt.url.MatchRequest(req) {
+			return rt, nil
+		}
+	}
+
+	var allow []string
+
+	// the routes are only probed for their methods, they must not record the
+	// params and route of req
+	for _, rt := range r.routes {
+		if !rt.methods.MatchRequest(req) && rt.url.Matches(req) {
+			allow = append(allow, rt.methods.Methods()...)
+		}
+	}
+
+	return nil, allow
+}
+
+// matched returns the route matched in the request phase, matching req when
+// there was none.
+func (r *Routes) matched(req *http.Request) *route {
+	ctx := martian.NewContext(req)
+
+	if ctx != nil {
+		if rt, ok := ctx.Get(r.ctxKey); ok {
+			return rt.(*route)
+		}
+	}
+
+	rt, _ := r.match(req)
+
+	return rt
+}
+
+// ModifyRequest runs the request modifier of the route of req.
+func (r *Routes) ModifyRequest(req *http.Request) error {
+	rt, allow := r.match(req)
+
+	if ctx := martian.NewContext(req); ctx != nil {
+		ctx.Set(r.ctxKey, rt)
+	}
+
+	if rt == nil {
+		log.Debugf("bffroute.Routes.ModifyRequest: no route for %s %s", req.Method, req.URL.Path)
+
+		if r.strict {
+			return r.reject(req, allow)
+		}
+
+		if r.reqmod != nil {
+			return r.reqmod.ModifyRequest(req)
+		}
+
+		return nil
+	}
+
+	log.Debugf("bffroute.Routes.ModifyRequest: matched routes[%d] for %s %s", rt.index, req.Method, req.URL.Path)
+
+	if rt.upstream != nil {
+		rt.upstream.ModifyRequest(req)
+	}
+
+	if rt.reqmod != nil {
+		return rt.reqmod.ModifyRequest(req)
+	}
+
+	return nil
+}
+
+func (r *Routes) reject(req *http.Request, allow []string) error {
+	err := &Error{Status: http.StatusNotFound, Method: req.Method, Path: req.URL.Path}
+
+	if len(allow) > 0 {
+		sort.Strings(allow)
+
+		err.Status = http.StatusMethodNotAllowed
+		err.Allow = dedupe(allow)
+	}
+
+	return err
+}
+
+func dedupe(sorted []string) []string {
+	out := sorted[:0]
+
+	for i, s := range sorted {
+		if i == 0 || s != sorted[i-1] {
+			out = append(out, s)
+		}
+	}
+
+	return out
+}
+
+// ModifyResponse runs the response modifier of the route of the request.
+func (r *Routes) ModifyResponse(res *http.Response) error {
+	rt := r.matched(res.Request)
+
+	if rt == nil {
+		if r.resmod != nil {
+			return r.resmod.ModifyResponse(res)
+		}
+
+		return nil
+	}
+
+	if rt.resmod != nil {
+		return rt.resmod.ModifyResponse(res)
+	}
+
+	return nil
+}
+
+// VerifyRequests returns the request verification errors of every route.
+func (r *Routes) VerifyRequests() error {
+	merr := martian.NewMultiError()
+
+	for _, reqmod := range r.requestModifiers() {
+		if reqv, ok := reqmod.(verify.RequestVerifier); ok {
+			if err := reqv.VerifyRequests(); err != nil {
+				merr.Add(err)
+			}
+		}
+	}
+
+	if merr.Empty() {
+		return nil
+	}
+
+	return merr
+}
+
+// ResetRequestVerifications resets the request verifications of every route.
+func (r *Routes) ResetRequestVerifications() {
+	for _, reqmod := range r.requestModifiers() {
+		if reqv, ok := reqmod.(verify.RequestVerifier); ok {
+			reqv.ResetRequestVerifications()
+		}
+	}
+}
+
+// VerifyResponses returns the response verification errors of every route.
+func (r *Routes) VerifyResponses() error {
+	merr := martian.NewMultiError()
+
+	for _, resmod := range r.responseModifiers() {
+		if resv, ok := resmod.(verify.ResponseVerifier); ok {
+			if err := resv.VerifyResponses(); err != nil {
+				merr.Add(err)
+			}
+		}
+	}
+
+	if merr.Empty() {
+		return nil
+	}
+
+	return merr
+}
+
+// ResetResponseVerifications resets the response verifications of every route.
+func (r *Routes) ResetResponseVerifications() {
+	for _, resmod := range r.responseModifiers() {
+		if resv, ok := resmod.(verify.ResponseVerifier); ok {
+			resv.ResetResponseVerifications()
+		}
+	}
+}
+
+func (r *Routes) requestModifiers() []martian.RequestModifier {
+	var mods []martian.RequestModifier
+
+	for _, rt := range r.routes {
+		if rt.reqmod != nil {
+			mods = append(mods, rt.reqmod)
+		}
+	}
+
+	if r.reqmod != nil {
+		mods = append(mods, r.reqmod)
+	}
+
+	return mods
+}
+
+func (r *Routes) responseModifiers() []martian.ResponseModifier {
+	var mods []martian.ResponseModifier
+
+	for _, rt := range r.routes {
+		if rt.resmod != nil {
+			mods = append(mods, rt.resmod)
+		}
+	}
+
+	if r.resmod != nil {
+		mods = append(mods, r.resmod)
+	}
+
+	return mods
+}
+
+// routesFromJSON builds a bffroute.Routes from JSON.
+//
+// Example modifier JSON:
+//
+//	{
+//	  "bff.Routes": {
+//	    "scope": ["request", "response"],
+//	    "strict": true,
+//	    "routes": [
+//	      {
+//	        "methods": ["GET"],
+//	        "path": "/users/me",
+//	        "modifier": { ... }
+//	      },
+//	      {
+//	        "methods": ["GET", "PUT"],
+//	        "host": "api.example.com",
+//	        "path": "/users/:id",
+//	        "upstream": "http://users.internal:8080",
+//	        "modifier": { ... }
+//	      }
+//	    ],
+//	    "else": { ... }
+//	  }
+//	}
+func routesFromJSON(b []byte) (*parse.Result, error) {
+	msg := &routesJSON{}
+
+	if err := json.Unmarshal(b, msg); err != nil {
+		return nil, err
+	}
+
+	if msg.Strict && len(msg.ElseModifier) > 0 {
+		return nil, fmt.Errorf("bff.Routes: strict routes have no else modifier")
+	}
+
+	routes := NewRoutes(msg.Strict)
+
+	for i, rj := range msg.Routes {
+		if rj.Path == "" && rj.Host == "" {
+			return nil, fmt.Errorf("bff.Routes: routes[%d]: path or host is required", i)
+		}
+
+		var up *url.URL
+
+		if rj.Upstream != "" {
+			u, err := upstream.Parse(rj.Upstream)
+
+			if err != nil {
+				return nil, fmt.Errorf("bff.Routes: routes[%d]: %v", i, err)
+			}
+
+			up = u
+		}
+
+		var reqmod martian.RequestModifier
+		var resmod martian.ResponseModifier
+
+		if len(rj.Modifier) > 0 {
+			m, err := bffparse.FromJSON(rj.Modifier)
+
+			if err != nil {
+				return nil, fmt.Errorf("bff.Routes: routes[%d]: %v", i, err)
+			}
+
+			if m != nil {
+				reqmod, resmod = m.RequestModifier(), m.ResponseModifier()
+			}
+		}
+
+		if err := routes.AddRoute(rj.Methods, &url.URL{Host: rj.Host, Path: rj.Path}, up, reqmod, resmod); err != nil {
+			return nil, fmt.Errorf("bff.Routes: routes[%d]: %v", i, err)
+		}
+	}
+
+	if len(msg.ElseModifier) > 0 {
+		em, err := bffparse.FromJSON(msg.ElseModifier)
+
+		if err != nil {
+			return nil, fmt.Errorf("bff.Routes: else: %v", err)
+		}
+
+		if em != nil {
+			routes.SetElse(em.RequestModifier(), em.ResponseModifier())
+		}
+	}
+
+	return parse.NewResult(routes, msg.Scope)
+}
@@ -0,0 +1,282 @@
+package bffroute
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/google/martian/v3"
+	"github.com/google/martian/v3/martiantest"
+	"github.com/google/martian/v3/parse"
+	"github.com/imranismail/bff/bffurl"
+
+	_ "github.com/google/martian/v3/header"
+)
+
+func TestRoutesPrecedence(t *testing.T) {
+	msg := []byte(`{
+	  "bff.Routes": {
+	    "scope": ["request"],
+	    "strict": true,
+	    "routes": [
+	      {
+	        "path": "/users/:id",
+	        "modifier": {"header.Modifier": {"scope": ["request"], "name": "X-Route", "value": "any-id"}}
+	      },
+	      {
+	        "methods": ["GET", "PUT"],
+	        "path": "/users/:id",
+	        "modifier": {"header.Modifier": {"scope": ["request"], "name": "X-Route", "value": "id"}}
+	      },
+	      {
+	        "methods": ["GET"],
+	        "path": "/users/me",
+	        "modifier": {"header.Modifier": {"scope": ["request"], "name": "X-Route", "value": "me"}}
+	      },
+	      {
+	        "methods": ["POST"],
+	        "path": "/users",
+	        "modifier": {"header.Modifier": {"scope": ["request"], "name": "X-Route", "value": "create"}}
+	      }
+	    ]
+	  }
+	}`)
+
+	r, err := parse.FromJSON(msg)
+	if err != nil {
+		t.Fatalf("parse.FromJSON(): got %v, want no error", err)
+	}
+
+	reqmod := r.RequestModifier()
+
+	tt := []struct {
+		method string
+		url    string
+		want   string
+		status int
+		allow  string
+	}{
+		{method: "GET", url: "http://example.com/users/me", want: "me"},
+		{method: "GET", url: "http://example.com/users/42", want: "id"},
+		{method: "PUT", url: "http://example.com/users/me", want: "id"},
+		{method: "DELETE", url: "http://example.com/users/42", want: "any-id"},
+		{method: "POST", url: "http://example.com/users", want: "create"},
+		{method: "GET", url: "http://example.com/users", status: 405, allow: "POST"},
+		{method: "GET", url: "http://example.com/posts", status: 404},
+	}
+
+	for i, tc := range tt {
+		req, err := http.NewRequest(tc.method, tc.url, nil)
+		if err != nil {
+			t.Fatalf("%d. http.NewRequest(): got %v, want no error", i, err)
+		}
+
+		_, remove, err := martian.TestContext(req, nil, nil)
+		if err != nil {
+			t.Fatalf("%d. martian.TestContext(): got %v, want no error", i, err)
+		}
+
+		err = reqmod.ModifyRequest(req)
+		remove()
+
+		if tc.status != 0 {
+			var rerr *Error
+
+			if !errors.As(err, &rerr) {
+				t.Fatalf("%d. ModifyRequest(): got %v, want *Error", i, err)
+			}
+			if got := rerr.Status; got != tc.status {
+				t.Errorf("%d. rerr.Status: got %d, want %d", i, got, tc.status)
+			}
+			if got := rerr.Headers().Get("Allow"); got != tc.allow {
+				t.Errorf("%d. rerr.Headers().Get(%q): got %q, want %q", i, "Allow", got, tc.allow)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%d. ModifyRequest(): got %v, want no error", i, err)
+		}
+		if got := req.Header.Get("X-Route"); got != tc.want {
+			t.Errorf("%d. %s %s: got route %q, want %q", i, tc.method, tc.url, got, tc.want)
+		}
+	}
+}
+
+func TestRoutesSpecificity(t *testing.T) {
+	routes := []struct {
+		name    string
+		methods []string
+		host    string
+		path    string
+	}{
+		{name: "catch-all", path: "/api/*rest"},
+		{name: "v1-catch-all", path: "/api/v1/*rest"},
+		{name: "optional", path: "/api/v1/users/:id?"},
+		{name: "param", path: "/api/v1/users/:id"},
+		{name: "numeric", path: "/api/v1/users/:id<[0-9]+>"},
+		{name: "json", path: "/api/v1/users/:id.json"},
+		{name: "me", path: "/api/v1/users/me"},
+		{name: "get-param", methods: []string{"GET"}, path: "/api/v1/users/:id"},
+		{name: "wildcard-host", host: "*.example.com", path: "/api/v1/teams/:id"},
+		{name: "param-host", host: ":tenant<[a-z]+>.example.com", path: "/api/v1/teams/:id"},
+		{name: "exact-host", host: "acme.example.com", path: "/api/v1/teams/:id"},
+		{name: "no-host", path: "/api/v1/teams/:id"},
+	}
+
+	tt := []struct {
+		method string
+		url    string
+		want   string
+		id     string
+	}{
+		{method: "GET", url: "http://example.com/api/v1/users/me", want: "me"},
+		{method: "GET", url: "http://example.com/api/v1/users/42", want: "numeric", id: "42"},
+		{method: "GET", url: "http://example.com/api/v1/users/42.json", want: "json", id: "42"},
+		{method: "GET", url: "http://example.com/api/v1/users/jane", want: "get-param", id: "jane"},
+		{method: "DELETE", url: "http://example.com/api/v1/users/jane", want: "param", id: "jane"},
+		{method: "GET", url: "http://example.com/api/v1/users", want: "optional"},
+		{method: "GET", url: "http://example.com/api/v1/posts/1", want: "v1-catch-all"},
+		{method: "GET", url: "http://example.com/api/v2/users", want: "catch-all"},
+		{method: "GET", url: "http://acme.example.com/api/v1/teams/7", want: "exact-host", id: "7"},
+		{method: "GET", url: "http://globex.example.com/api/v1/teams/7", want: "param-host", id: "7"},
+		{method: "GET", url: "http://team7.example.com/api/v1/teams/7", want: "wildcard-host", id: "7"},
+		{method: "GET", url: "http://example.org/api/v1/teams/7", want: "no-host", id: "7"},
+	}
+
+	// the config order makes no difference
+	for _, reversed := range []bool{false, true} {
+		r := NewRoutes(true)
+
+		for n := range routes {
+			rt := routes[n]
+			if reversed {
+				rt = routes[len(routes)-1-n]
+			}
+
+			name := rt.name
+			err := r.AddRoute(rt.methods, &url.URL{Host: rt.host, Path: rt.path}, nil, martian.RequestModifierFunc(func(req *http.Request) error {
+				req.Header.Set("X-Route", name)
+				return nil
+			}), nil)
+			if err != nil {
+				t.Fatalf("AddRoute(%s): got %v, want no error", rt.name, err)
+			}
+		}
+
+		for i, tc := range tt {
+			req, err := http.NewRequest(tc.method, tc.url, nil)
+			if err != nil {
+				t.Fatalf("%d. http.NewRequest(): got %v, want no error", i, err)
+			}
+
+			ctx, remove, err := martian.TestContext(req, nil, nil)
+			if err != nil {
+				t.Fatalf("%d. martian.TestContext(): got %v, want no error", i, err)
+			}
+
+			if err := r.ModifyRequest(req); err != nil {
+				t.Fatalf("%d. ModifyRequest(): got %v, want no error", i, err)
+			}
+			if got := req.Header.Get("X-Route"); got != tc.want {
+				t.Errorf("%d. reversed %t: %s %s: got route %q, want %q", i, reversed, tc.method, tc.url, got, tc.want)
+			}
+
+			// only the params of the matched route are captured
+			if got, _ := ctx.Get("bffurl.ParamName.id"); tc.id != "" && got != tc.id {
+				t.Errorf("%d. reversed %t: param id: got %v, want %q", i, reversed, got, tc.id)
+			}
+
+			remove()
+		}
+	}
+}
+
+func TestRoutesElse(t *testing.T) {
+	routes := NewRoutes(false)
+
+	matched := martiantest.NewModifier()
+	unmatched := martiantest.NewModifier()
+
+	if err := routes.AddRoute([]string{"GET"}, &url.URL{Path: "/users/:id"}, nil, matched, matched); err != nil {
+		t.Fatalf("AddRoute(): got %v, want no error", err)
+	}
+	routes.SetElse(unmatched, unmatched)
+
+	req, err := http.NewRequest("GET", "http://example.com/posts/1", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest(): got %v, want no error", err)
+	}
+
+	_, remove, err := martian.TestContext(req, nil, nil)
+	if err != nil {
+		t.Fatalf("martian.TestContext(): got %v, want no error", err)
+	}
+	defer remove()
+
+	if err := routes.ModifyRequest(req); err != nil {
+		t.Fatalf("ModifyRequest(): got %v, want no error", err)
+	}
+
+	res := &http.Response{Request: req, Header: http.Header{}}
+
+	if err := routes.ModifyResponse(res); err != nil {
+		t.Fatalf("ModifyResponse(): got %v, want no error", err)
+	}
+
+	if matched.RequestModified() || matched.ResponseModified() {
+		t.Error("matched.Modified(): got true, want false")
+	}
+	if !unmatched.RequestModified() || !unmatched.ResponseModified() {
+		t.Error("unmatched.Modified(): got false, want true")
+	}
+}
+
+func TestAddRouteErrors(t *testing.T) {
+	tt := []*url.URL{
+		{Path: "/users/:id<[0-9+>"},
+		{Path: "/users/:id<[0-9]+"},
+		{Host: ":tenant<[a-z]+.example.com", Path: "/users"},
+	}
+
+	for i, u := range tt {
+		r := NewRoutes(false)
+
+		if err := r.AddRoute(nil, u, nil, nil, nil); err == nil {
+			t.Errorf("%d. AddRoute(%s%s): got no error, want error", i, u.Host, u.Path)
+		}
+	}
+}
+
+func TestRoutesMethodNotAllowedRecordsNothing(t *testing.T) {
+	routes := NewRoutes(true)
+
+	if err := routes.AddRoute([]string{"GET"}, &url.URL{Path: "/users/:id"}, nil, nil, nil); err != nil {
+		t.Fatalf("AddRoute(): got %v, want no error", err)
+	}
+
+	req, err := http.NewRequest("DELETE", "http://example.com/users/42", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest(): got %v, want no error", err)
+	}
+
+	ctx, remove, err := martian.TestContext(req, nil, nil)
+	if err != nil {
+		t.Fatalf("martian.TestContext(): got %v, want no error", err)
+	}
+	defer remove()
+
+	var rerr *Error
+	if err := routes.ModifyRequest(req); !errors.As(err, &rerr) || rerr.Status != http.StatusMethodNotAllowed {
+		t.Fatalf("ModifyRequest(): got %v, want a 405 *Error", err)
+	}
+
+	if got, ok := ctx.Get("bffurl.ParamName.id"); ok {
+		t.Errorf("param id: got %q, want unset", got)
+	}
+	if got := bffurl.Route(ctx); got != "" {
+		t.Errorf("bffurl.Route(): got %q, want none", got)
+	}
+}
@@ -16,12 +16,14 @@ package bffstatus
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 
 	"github.com/google/martian/v3"
 	"github.com/google/martian/v3/filter"
 	"github.com/google/martian/v3/log"
 	"github.com/google/martian/v3/parse"
+	"github.com/imranismail/bff/bffparse"
 )
 
 var noop = martian.Noop("status.Filter")
@@ -30,13 +32,16 @@ func init() {
 	parse.Register("status.Filter", filterFromJSON)
 }
 
-// Filter runs modifiers if the response status code matches the specified status code.
+// Filter runs modifiers if the response status code matches the specified
+// status codes, or on requests if the recorded upstream status code does.
 type Filter struct {
 	*filter.Filter
+	matcher *Matcher
 }
 
 type filterJSON struct {
-	StatusCode   []int                `json:"statusCode"`
+	StatusCode   Ranges               `json:"statusCode"`
+	Not          Ranges               `json:"not"`
 	Modifier     json.RawMessage      `json:"modifier"`
 	ElseModifier json.RawMessage      `json:"else"`
 	Scope        []parse.ModifierType `json:"scope"`
@@ -44,7 +49,8 @@ type filterJSON struct {
 
 // Example JSON configuration message:
 // {
-//   "statusCode": 401,
+//   "statusCode": [401, "500-503", "5xx"],
+//   "not": [501],
 //   "scope": ["request", "response"],
 //   "modifier": { ... }
 //   "else": { ... }
@@ -55,9 +61,21 @@ func filterFromJSON(b []byte) (*parse.Result, error) {
 		return nil, err
 	}
 
-	filter := NewFilter(msg.StatusCode)
+	if len(msg.StatusCode) == 0 && len(msg.Not) == 0 {
+		return nil, fmt.Errorf("status.Filter: statusCode or not is required")
+	}
+
+	filter := NewFilter(nil)
+
+	for _, r := range msg.StatusCode {
+		filter.AddRange(r)
+	}
 
-	m, err := parse.FromJSON(msg.Modifier)
+	for _, r := range msg.Not {
+		filter.Exclude(r)
+	}
+
+	m, err := bffparse.FromJSON(msg.Modifier)
 	if err != nil {
 		return nil, err
 	}
@@ -66,7 +84,7 @@ func filterFromJSON(b []byte) (*parse.Result, error) {
 	filter.ResponseWhenTrue(m.ResponseModifier())
 
 	if len(msg.ElseModifier) > 0 {
-		em, err := parse.FromJSON(msg.ElseModifier)
+		em, err := bffparse.FromJSON(msg.ElseModifier)
 		if err != nil {
 			return nil, err
 		}
@@ -89,43 +107,81 @@ func NewFilter(statusCode []int) *Filter {
 	f := filter.New()
 	f.SetRequestCondition(m)
 	f.SetResponseCondition(m)
-	return &Filter{f}
+	return &Filter{Filter: f, matcher: m}
 }
 
-// Matcher is a conditional evaluator of response statud code to be used in
+// AddRange adds a range of status codes to match.
+func (f *Filter) AddRange(r Range) {
+	f.matcher.AddRange(r)
+}
+
+// Exclude adds a range of status codes not to match.
+func (f *Filter) Exclude(r Range) {
+	f.matcher.Exclude(r)
+}
+
+// Matcher is a conditional evaluator of response status code to be used in
 // filters that take conditionals.
 type Matcher struct {
-	statusCode []int
+	ranges Ranges
+	not    Ranges
 }
 
 // NewMatcher builds a new status code matcher.
 func NewMatcher(statusCode []int) *Matcher {
-	return &Matcher{
-		statusCode: statusCode,
+	m := &Matcher{}
+
+	for _, sc := range statusCode {
+		m.AddRange(Range{Min: sc, Max: sc})
 	}
+
+	return m
+}
+
+// AddRange adds a range of status codes to match, every status code matches
+// when there are none.
+func (m *Matcher) AddRange(r Range) {
+	m.ranges = append(m.ranges, r)
+}
+
+// Exclude adds a range of status codes not to match.
+func (m *Matcher) Exclude(r Range) {
+	m.not = append(m.not, r)
 }
 
-// MatchRequest always returns false since request will not have any status code.
+// MatchRequest returns true if the upstream status code recorded for the
+// request matches, and false when there is none.
 func (m *Matcher) MatchRequest(req *http.Request) bool {
-	return false
+	statusCode, ok := StatusCode(req)
+
+	if !ok {
+		return false
+	}
+
+	matched := m.matches(statusCode)
+
+	if matched {
+		log.Debugf("status.Matcher.MatchRequest: matched: %d", statusCode)
+	}
+
+	return matched
 }
 
-// MatchResponse retuns true if m.StatusCode matches res.StatusCode.
+// MatchResponse retuns true if res.StatusCode matches.
 func (m *Matcher) MatchResponse(res *http.Response) bool {
 	matched := m.matches(res.StatusCode)
 
 	if matched {
-		log.Debugf("status.Matcher.MatchResponse: matched: %s", m.statusCode)
+		log.Debugf("status.Matcher.MatchResponse: matched: %d", res.StatusCode)
 	}
 
 	return matched
 }
 
 func (m *Matcher) matches(statusCode int) bool {
-	for _, sc := range m.statusCode {
-		if statusCode == sc {
-			return true
-		}
+	if len(m.ranges) > 0 && !m.ranges.Contains(statusCode) {
+		return false
 	}
-	return false
+
+	return !m.not.Contains(statusCode)
 }
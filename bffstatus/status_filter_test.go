@@ -0,0 +1,186 @@
+package bffstatus
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/martian/v3"
+	"github.com/google/martian/v3/martiantest"
+	"github.com/google/martian/v3/parse"
+	"github.com/google/martian/v3/proxyutil"
+
+	_ "github.com/google/martian/v3/header"
+)
+
+func TestParseRange(t *testing.T) {
+	tt := []struct {
+		raw  string
+		want Range
+	}{
+		{raw: "404", want: Range{Min: 404, Max: 404}},
+		{raw: "500-503", want: Range{Min: 500, Max: 503}},
+		{raw: "5xx", want: Range{Min: 500, Max: 599}},
+		{raw: "2XX", want: Range{Min: 200, Max: 299}},
+	}
+
+	for i, tc := range tt {
+		got, err := ParseRange(tc.raw)
+		if err != nil {
+			t.Fatalf("%d. ParseRange(%q): got %v, want no error", i, tc.raw, err)
+		}
+		if got != tc.want {
+			t.Errorf("%d. ParseRange(%q): got %v, want %v", i, tc.raw, got, tc.want)
+		}
+	}
+
+	for i, raw := range []string{"", "6xx", "503-500", "abc", "99", "1000"} {
+		if _, err := ParseRange(raw); err == nil {
+			t.Errorf("%d. ParseRange(%q): got no error, want error", i, raw)
+		}
+	}
+}
+
+func TestFilterFromJSON(t *testing.T) {
+	msg := []byte(`{
+	  "status.Filter": {
+	    "scope": ["request", "response"],
+	    "statusCode": ["5xx", 429],
+	    "not": [501],
+	    "modifier": {
+	      "header.Modifier": {"scope": ["request", "response"], "name": "Mod-Run", "value": "true"}
+	    }
+	  }
+	}`)
+
+	r, err := parse.FromJSON(msg)
+	if err != nil {
+		t.Fatalf("parse.FromJSON(): got %v, want no error", err)
+	}
+
+	for _, tc := range []struct {
+		code int
+		want bool
+	}{
+		{code: 500, want: true},
+		{code: 599, want: true},
+		{code: 429, want: true},
+		{code: 501, want: false},
+		{code: 200, want: false},
+	} {
+		req, err := http.NewRequest("GET", "http://example.com", nil)
+		if err != nil {
+			t.Fatalf("http.NewRequest(): got %v, want no error", err)
+		}
+
+		res := proxyutil.NewResponse(tc.code, nil, req)
+
+		if err := r.ResponseModifier().ModifyResponse(res); err != nil {
+			t.Fatalf("ModifyResponse(): got %v, want no error", err)
+		}
+		if got := res.Header.Get("Mod-Run") == "true"; got != tc.want {
+			t.Errorf("%d: got modified %t, want %t", tc.code, got, tc.want)
+		}
+	}
+}
+
+func TestMatchRequest(t *testing.T) {
+	req, err := http.NewRequest("GET", "http://example.com", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest(): got %v, want no error", err)
+	}
+
+	_, remove, err := martian.TestContext(req, nil, nil)
+	if err != nil {
+		t.Fatalf("martian.TestContext(): got %v, want no error", err)
+	}
+	defer remove()
+
+	f := NewFilter(nil)
+	f.AddRange(Range{Min: 500, Max: 599})
+	tm := martiantest.NewModifier()
+	f.SetRequestModifier(tm)
+
+	if err := f.ModifyRequest(req); err != nil {
+		t.Fatalf("ModifyRequest(): got %v, want no error", err)
+	}
+	if tm.RequestModified() {
+		t.Error("tm.RequestModified(): got true with no status code, want false")
+	}
+
+	SetStatusCode(req, 503)
+
+	if err := f.ModifyRequest(req); err != nil {
+		t.Fatalf("ModifyRequest(): got %v, want no error", err)
+	}
+	if !tm.RequestModified() {
+		t.Error("tm.RequestModified(): got false, want true")
+	}
+}
+
+func TestFilterFromJSONNotOnly(t *testing.T) {
+	r, err := parse.FromJSON([]byte(`{
+	  "status.Filter": {
+	    "scope": ["request", "response"],
+	    "not": [200, 204],
+	    "modifier": {
+	      "header.Modifier": {"scope": ["request", "response"], "name": "Mod-Run", "value": "true"}
+	    }
+	  }
+	}`))
+	if err != nil {
+		t.Fatalf("parse.FromJSON(): got %v, want no error", err)
+	}
+
+	tt := []struct {
+		code int
+		want bool
+	}{
+		{code: 200, want: false},
+		{code: 204, want: false},
+		{code: 404, want: true},
+		{code: 503, want: true},
+	}
+
+	for i, tc := range tt {
+		req, err := http.NewRequest("GET", "http://example.com", nil)
+		if err != nil {
+			t.Fatalf("%d. http.NewRequest(): got %v, want no error", i, err)
+		}
+
+		_, remove, err := martian.TestContext(req, nil, nil)
+		if err != nil {
+			t.Fatalf("%d. martian.TestContext(): got %v, want no error", i, err)
+		}
+
+		SetStatusCode(req, tc.code)
+
+		if err := r.RequestModifier().ModifyRequest(req); err != nil {
+			t.Fatalf("%d. ModifyRequest(): got %v, want no error", i, err)
+		}
+		if got := req.Header.Get("Mod-Run") == "true"; got != tc.want {
+			t.Errorf("%d. request after %d: got modified %t, want %t", i, tc.code, got, tc.want)
+		}
+
+		res := proxyutil.NewResponse(tc.code, nil, req)
+
+		if err := r.ResponseModifier().ModifyResponse(res); err != nil {
+			t.Fatalf("%d. ModifyResponse(): got %v, want no error", i, err)
+		}
+		if got := res.Header.Get("Mod-Run") == "true"; got != tc.want {
+			t.Errorf("%d. response %d: got modified %t, want %t", i, tc.code, got, tc.want)
+		}
+
+		remove()
+	}
+}
+
+func TestFilterFromJSONErrors(t *testing.T) {
+	for i, msg := range []string{
+		`{"status.Filter": {"modifier": {"header.Modifier": {"name": "Mod-Run", "value": "true"}}}}`,
+		`{"status.Filter": {"statusCode": [], "not": [], "modifier": {"header.Modifier": {"name": "Mod-Run", "value": "true"}}}}`,
+	} {
+		if _, err := parse.FromJSON([]byte(msg)); err == nil {
+			t.Errorf("%d. parse.FromJSON(%s): got no error, want error", i, msg)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package bffstatus
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/martian/v3"
+)
+
+const statusCodeKey = "bffstatus.StatusCode"
+
+// Range is an inclusive range of status codes.
+type Range struct {
+	Min int
+	Max int
+}
+
+// ParseRange parses a status code `404`, a range `500-599` or a class `5xx`.
+func ParseRange(s string) (Range, error) {
+	s = strings.TrimSpace(s)
+
+	if len(s) == 3 && strings.HasSuffix(strings.ToLower(s), "xx") && s[0] >= '1' && s[0] <= '5' {
+		class := int(s[0]-'0') * 100
+
+		return Range{Min: class, Max: class + 99}, nil
+	}
+
+	if i := strings.Index(s, "-"); i > 0 {
+		min, err := parseCode(s[:i])
+
+		if err != nil {
+			return Range{}, err
+		}
+
+		max, err := parseCode(s[i+1:])
+
+		if err != nil {
+			return Range{}, err
+		}
+
+		if min > max {
+			return Range{}, fmt.Errorf("status.Filter: invalid range %q", s)
+		}
+
+		return Range{Min: min, Max: max}, nil
+	}
+
+	code, err := parseCode(s)
+
+	if err != nil {
+		return Range{}, err
+	}
+
+	return Range{Min: code, Max: code}, nil
+}
+
+func parseCode(s string) (int, error) {
+	code, err := strconv.Atoi(strings.TrimSpace(s))
+
+	if err != nil || code < 100 || code > 599 {
+		return 0, fmt.Errorf("status.Filter: invalid status code %q", s)
+	}
+
+	return code, nil
+}
+
+// Contains returns whether code is in the range.
+func (r Range) Contains(code int) bool {
+	return code >= r.Min && code <= r.Max
+}
+
+// Ranges is a list of ranges, in JSON a list of status codes, ranges and
+// classes such as [404, "500-503", "5xx"].
+type Ranges []Range
+
+// UnmarshalJSON parses a list of ranges, or a single status code.
+func (rs *Ranges) UnmarshalJSON(b []byte) error {
+	var values []interface{}
+
+	if err := json.Unmarshal(b, &values); err != nil {
+		var value interface{}
+
+		if err := json.Unmarshal(b, &value); err != nil {
+			return err
+		}
+
+		values = []interface{}{value}
+	}
+
+	for _, value := range values {
+		var r Range
+		var err error
+
+		switch v := value.(type) {
+		case float64:
+			r, err = ParseRange(strconv.Itoa(int(v)))
+		case string:
+			r, err = ParseRange(v)
+		default:
+			err = fmt.Errorf("status.Filter: invalid status code %v", v)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		*rs = append(*rs, r)
+	}
+
+	return nil
+}
+
+// Contains returns whether code is in any of the ranges.
+func (rs Ranges) Contains(code int) bool {
+	for _, r := range rs {
+		if r.Contains(code) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetStatusCode records an upstream response status for the request phase of
+// the modifiers of req, such as the status of a fetched resource.
+func SetStatusCode(req *http.Request, code int) {
+	if ctx := martian.NewContext(req); ctx != nil {
+		ctx.Set(statusCodeKey, code)
+	}
+}
+
+// StatusCode returns the last status recorded by SetStatusCode for req.
+func StatusCode(req *http.Request) (int, bool) {
+	ctx := martian.NewContext(req)
+
+	if ctx == nil {
+		return 0, false
+	}
+
+	code, ok := ctx.Get(statusCodeKey)
+
+	if !ok {
+		return 0, false
+	}
+
+	return code.(int), true
+}
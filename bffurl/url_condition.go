@@ -0,0 +1,149 @@
+package bffurl
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+
+	"github.com/google/martian/v3"
+)
+
+// Condition is a condition on a query param or a header of a request. It is
+// met when one of the values of name equals value, or matches the regex, or
+// when name is present at all if neither is set.
+type Condition struct {
+	name  string
+	value string
+	re    *regexp.Regexp
+}
+
+// ConditionJSON is the config of a Condition.
+type ConditionJSON struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Regex string `json:"regex"`
+}
+
+// NewCondition builds a condition on name, value and regex are exclusive.
+func NewCondition(name, value, regex string) (*Condition, error) {
+	if name == "" {
+		return nil, fmt.Errorf("bffurl.Condition: name is required")
+	}
+
+	c := &Condition{name: name, value: value}
+
+	if regex == "" {
+		return c, nil
+	}
+
+	if value != "" {
+		return nil, fmt.Errorf("bffurl.Condition: %s: value and regex are exclusive", name)
+	}
+
+	re, err := regexp.Compile(regex)
+
+	if err != nil {
+		return nil, fmt.Errorf("bffurl.Condition: %s: %v", name, err)
+	}
+
+	c.re = re
+
+	return c, nil
+}
+
+// parseConditions builds the conditions of their configs.
+func parseConditions(msgs []ConditionJSON) ([]*Condition, error) {
+	var conds []*Condition
+
+	for _, msg := range msgs {
+		c, err := NewCondition(msg.Name, msg.Value, msg.Regex)
+
+		if err != nil {
+			return nil, err
+		}
+
+		conds = append(conds, c)
+	}
+
+	return conds, nil
+}
+
+// match returns the first of values meeting the condition.
+func (c *Condition) match(values []string) (string, bool) {
+	for _, v := range values {
+		switch {
+		case c.re != nil && !c.re.MatchString(v):
+		case c.re == nil && c.value != "" && v != c.value:
+		default:
+			return v, true
+		}
+	}
+
+	return "", false
+}
+
+// MatchQuery returns whether the query of req meets the condition, the
+// matching value is captured as a param of the same name unless a path or
+// host param of that name was captured already.
+func (c *Condition) MatchQuery(req *http.Request) bool {
+	v, ok := c.captureQuery(req)
+
+	if ok {
+		c.setQuery(req, v)
+	}
+
+	return ok
+}
+
+// captureQuery returns the value of the query of req meeting the condition.
+func (c *Condition) captureQuery(req *http.Request) (string, bool) {
+	return c.match(req.URL.Query()[c.name])
+}
+
+// setQuery records v as the param of the condition, a query param never
+// replaces a param of the same name so that a client can't override it.
+func (c *Condition) setQuery(req *http.Request, v string) {
+	ctx := martian.NewContext(req)
+
+	if ctx == nil {
+		return
+	}
+
+	param := Param{name: c.name}
+
+	if _, ok := ctx.Get(param.Name()); !ok {
+		ctx.Set(param.Name(), v)
+	}
+}
+
+// MatchHeader returns whether the headers of req meet the condition.
+func (c *Condition) MatchHeader(req *http.Request) bool {
+	_, ok := c.match(req.Header.Values(c.name))
+
+	return ok
+}
+
+// containsQuery returns whether every value of want is in got, whatever their
+// order and other params of got.
+func containsQuery(got, want url.Values) bool {
+	for name, values := range want {
+		for _, value := range values {
+			if !contains(got[name], value) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
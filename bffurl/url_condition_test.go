@@ -0,0 +1,146 @@
+package bffurl
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/martian/v3"
+	"github.com/google/martian/v3/parse"
+)
+
+func TestFilterConditions(t *testing.T) {
+	msg := []byte(`{
+	  "bff.URLFilter": {
+	    "scope": ["request"],
+	    "path": "/search",
+	    "query": "b=2&a=1",
+	    "queryParams": [
+	      {"name": "page", "regex": "^[0-9]+$"},
+	      {"name": "debug"}
+	    ],
+	    "headers": [
+	      {"name": "X-Tenant", "value": "acme"}
+	    ],
+	    "modifier": {
+	      "header.Modifier": {"scope": ["request"], "name": "Mod-Run", "value": "true"}
+	    }
+	  }
+	}`)
+
+	r, err := parse.FromJSON(msg)
+	if err != nil {
+		t.Fatalf("parse.FromJSON(): got %v, want no error", err)
+	}
+
+	tt := []struct {
+		url    string
+		tenant string
+		want   bool
+	}{
+		{url: "http://example.com/search?a=1&b=2&page=3&debug", tenant: "acme", want: true},
+		{url: "http://example.com/search?debug=&x=y&page=3&b=2&a=1", tenant: "acme", want: true},
+		{url: "http://example.com/search?a=1&b=2&page=3&debug", tenant: "other", want: false},
+		{url: "http://example.com/search?a=1&b=2&page=3", tenant: "acme", want: false},
+		{url: "http://example.com/search?a=1&b=2&page=x&debug", tenant: "acme", want: false},
+		{url: "http://example.com/search?a=1&page=3&debug", tenant: "acme", want: false},
+	}
+
+	for i, tc := range tt {
+		req, err := http.NewRequest("GET", tc.url, nil)
+		if err != nil {
+			t.Fatalf("%d. http.NewRequest(): got %v, want no error", i, err)
+		}
+		req.Header.Set("X-Tenant", tc.tenant)
+
+		ctx, remove, err := martian.TestContext(req, nil, nil)
+		if err != nil {
+			t.Fatalf("%d. martian.TestContext(): got %v, want no error", i, err)
+		}
+
+		if err := r.RequestModifier().ModifyRequest(req); err != nil {
+			t.Fatalf("%d. ModifyRequest(): got %v, want no error", i, err)
+		}
+
+		if got := req.Header.Get("Mod-Run") == "true"; got != tc.want {
+			t.Errorf("%d. %s: got modified %t, want %t", i, tc.url, got, tc.want)
+		}
+
+		if tc.want {
+			if got, _ := ctx.Get("bffurl.ParamName.page"); got != "3" {
+				t.Errorf("%d. param page: got %v, want %q", i, got, "3")
+			}
+		}
+
+		remove()
+	}
+}
+
+func TestNewConditionErrors(t *testing.T) {
+	tt := []ConditionJSON{
+		{Value: "x"},
+		{Name: "page", Regex: "[0-9"},
+		{Name: "page", Value: "1", Regex: "[0-9]+"},
+	}
+
+	for i, tc := range tt {
+		if _, err := NewCondition(tc.Name, tc.Value, tc.Regex); err == nil {
+			t.Errorf("%d. NewCondition(%q, %q, %q): got no error, want error", i, tc.Name, tc.Value, tc.Regex)
+		}
+	}
+}
+
+func TestFilterQueryParamCollision(t *testing.T) {
+	for i, msg := range []string{
+		`{"bff.URLFilter": {"path": "/users/:id", "queryParams": [{"name": "id"}]}}`,
+		`{"bff.URLFilter": {"host": ":id.example.com", "queryParams": [{"name": "id"}]}}`,
+	} {
+		if _, err := parse.FromJSON([]byte(msg)); err == nil {
+			t.Errorf("%d. parse.FromJSON(%s): got no error, want error", i, msg)
+		}
+	}
+}
+
+func TestFilterQueryParamKeepsPathParam(t *testing.T) {
+	msg := []byte(`{
+	  "bff.URLFilter": {
+	    "scope": ["request"],
+	    "path": "/users/:id",
+	    "modifier": {
+	      "bff.URLFilter": {
+	        "scope": ["request"],
+	        "queryParams": [{"name": "id"}],
+	        "modifier": {
+	          "header.Modifier": {"scope": ["request"], "name": "Mod-Run", "value": "true"}
+	        }
+	      }
+	    }
+	  }
+	}`)
+
+	r, err := parse.FromJSON(msg)
+	if err != nil {
+		t.Fatalf("parse.FromJSON(): got %v, want no error", err)
+	}
+
+	req, err := http.NewRequest("GET", "http://example.com/users/42?id=1", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest(): got %v, want no error", err)
+	}
+
+	ctx, remove, err := martian.TestContext(req, nil, nil)
+	if err != nil {
+		t.Fatalf("martian.TestContext(): got %v, want no error", err)
+	}
+	defer remove()
+
+	if err := r.RequestModifier().ModifyRequest(req); err != nil {
+		t.Fatalf("ModifyRequest(): got %v, want no error", err)
+	}
+
+	if got := req.Header.Get("Mod-Run"); got != "true" {
+		t.Errorf("req.Header.Get(%q): got %q, want %q", "Mod-Run", got, "true")
+	}
+	if got, _ := ctx.Get("bffurl.ParamName.id"); got != "42" {
+		t.Errorf("param id: got %v, want %q", got, "42")
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/google/martian/v3/filter"
 	"github.com/google/martian/v3/log"
 	"github.com/google/martian/v3/parse"
+	"github.com/imranismail/bff/bffparse"
 )
 
 var noop = martian.Noop("bff.URLFilter")
@@ -33,6 +34,7 @@ func init() {
 // Filter runs modifiers iff the request URL matches all of the segments in url.
 type Filter struct {
 	*filter.Filter
+	matcher *Matcher
 }
 
 type filterJSON struct {
@@ -40,6 +42,8 @@ type filterJSON struct {
 	Host         string               `json:"host"`
 	Path         string               `json:"path"`
 	Query        string               `json:"query"`
+	QueryParams  []ConditionJSON      `json:"queryParams"`
+	Headers      []ConditionJSON      `json:"headers"`
 	Modifier     json.RawMessage      `json:"modifier"`
 	ElseModifier json.RawMessage      `json:"else"`
 	Scope        []parse.ModifierType `json:"scope"`
@@ -47,14 +51,29 @@ type filterJSON struct {
 
 // NewFilter constructs a filter that applies the modifer when the
 // request URL matches all of the provided URL segments.
-func NewFilter(u *url.URL) *Filter {
+func NewFilter(u *url.URL) (*Filter, error) {
 	log.Debugf("bff.NewURLFilter: %s", u)
 
-	m := NewMatcher(u)
+	m, err := NewMatcher(u)
+	if err != nil {
+		return nil, err
+	}
+
 	f := filter.New()
 	f.SetRequestCondition(m)
 	f.SetResponseCondition(m)
-	return &Filter{f}
+	return &Filter{Filter: f, matcher: m}, nil
+}
+
+// AddQueryCondition adds a condition on the query params of the request url,
+// it fails when the param is named like a path or host param.
+func (f *Filter) AddQueryCondition(c *Condition) error {
+	return f.matcher.AddQueryCondition(c)
+}
+
+// AddHeaderCondition adds a condition on the headers of the request.
+func (f *Filter) AddHeaderCondition(c *Condition) {
+	f.matcher.AddHeaderCondition(c)
 }
 
 // filterFromJSON takes a JSON message as a byte slice and returns a
@@ -67,6 +86,13 @@ func NewFilter(u *url.URL) *Filter {
 //   "host": "example.com",
 //   "path": "/foo/bar",
 //   "query": "q=value",
+//   "queryParams": [
+//     { "name": "page", "regex": "^[0-9]+$" },
+//     { "name": "debug" }
+//   ],
+//   "headers": [
+//     { "name": "X-Tenant", "value": "acme" }
+//   ],
 //   "scope": ["request", "response"],
 //   "modifier": { ... }
 //   "else": { ... }
@@ -77,14 +103,37 @@ func filterFromJSON(b []byte) (*parse.Result, error) {
 		return nil, err
 	}
 
-	filter := NewFilter(&url.URL{
+	query, err := parseConditions(msg.QueryParams)
+	if err != nil {
+		return nil, err
+	}
+
+	headers, err := parseConditions(msg.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := NewFilter(&url.URL{
 		Scheme:   msg.Scheme,
 		Host:     msg.Host,
 		Path:     msg.Path,
 		RawQuery: msg.Query,
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range query {
+		if err := filter.AddQueryCondition(c); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, c := range headers {
+		filter.AddHeaderCondition(c)
+	}
 
-	m, err := parse.FromJSON(msg.Modifier)
+	m, err := bffparse.FromJSON(msg.Modifier)
 	if err != nil {
 		return nil, err
 	}
@@ -93,7 +142,7 @@ func filterFromJSON(b []byte) (*parse.Result, error) {
 	filter.ResponseWhenTrue(m.ResponseModifier())
 
 	if len(msg.ElseModifier) > 0 {
-		em, err := parse.FromJSON(msg.ElseModifier)
+		em, err := bffparse.FromJSON(msg.ElseModifier)
 		if err != nil {
 			return nil, err
 		}
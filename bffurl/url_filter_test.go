@@ -103,7 +103,10 @@ func TestFilterModifyRequest(t *testing.T) {
 			t.Fatalf("%d. NewRequest(): got %v, want no error", i, err)
 		}
 
-		mod := NewFilter(tc.url)
+		mod, err := NewFilter(tc.url)
+		if err != nil {
+			t.Fatalf("%d. NewFilter(): got %v, want no error", i, err)
+		}
 		tm := martiantest.NewModifier()
 		mod.SetRequestModifier(tm)
 
@@ -193,7 +196,10 @@ func TestFilterModifyResponse(t *testing.T) {
 		}
 		res := proxyutil.NewResponse(200, nil, req)
 
-		mod := NewFilter(tc.url)
+		mod, err := NewFilter(tc.url)
+		if err != nil {
+			t.Fatalf("%d. NewFilter(): got %v, want no error", i, err)
+		}
 		tm := martiantest.NewModifier()
 		mod.SetResponseModifier(tm)
 
@@ -288,7 +294,10 @@ func TestFilterFromJSON(t *testing.T) {
 
 func TestPassThroughVerifyRequests(t *testing.T) {
 	u := &url.URL{Host: "www.martian.local"}
-	f := NewFilter(u)
+	f, err := NewFilter(u)
+	if err != nil {
+		t.Fatalf("NewFilter(): got %v, want no error", err)
+	}
 
 	if err := f.VerifyRequests(); err != nil {
 		t.Fatalf("VerifyRequest(): got %v, want no error", err)
@@ -307,7 +316,10 @@ func TestPassThroughVerifyRequests(t *testing.T) {
 
 func TestPassThroughVerifyResponses(t *testing.T) {
 	u := &url.URL{Host: "www.martian.local"}
-	f := NewFilter(u)
+	f, err := NewFilter(u)
+	if err != nil {
+		t.Fatalf("NewFilter(): got %v, want no error", err)
+	}
 	if err := f.VerifyResponses(); err != nil {
 		t.Fatalf("VerifyResponses(): got %v, want no error", err)
 	}
@@ -325,7 +337,10 @@ func TestPassThroughVerifyResponses(t *testing.T) {
 
 func TestResets(t *testing.T) {
 	u := &url.URL{Host: "www.martian.local"}
-	f := NewFilter(u)
+	f, err := NewFilter(u)
+	if err != nil {
+		t.Fatalf("NewFilter(): got %v, want no error", err)
+	}
 
 	tv := &verify.TestVerifier{
 		ResponseError: errors.New("verify response failure"),
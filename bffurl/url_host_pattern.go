@@ -0,0 +1,193 @@
+package bffurl
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/google/martian/v3"
+	"github.com/google/martian/v3/martianurl"
+)
+
+// hostTokenRe matches a param of a host pattern, `:name` with an optional
+// `<regex>` constraint. Names start with a letter so that a port is no param.
+var hostTokenRe = regexp.MustCompile(`:([A-Za-z_][^.:<>*]*)(?:<([^>]*)>)?`)
+
+// HostPattern is a host pattern, its params capture labels of the request host
+// into the martian context like the params of a Pattern.
+//
+//	:tenant.api.example.com          :tenant captures the first label
+//	:tenant<[a-z]+>.api.example.com  the label must match the regex
+//	*.example.com                    a wildcard label, nothing is captured
+type HostPattern struct {
+	raw    string
+	params Params
+	re     *regexp.Regexp
+}
+
+// ParseHostPattern parses a host pattern, it fails on an invalid constraint.
+func ParseHostPattern(raw string) (*HostPattern, error) {
+	p := &HostPattern{raw: raw}
+
+	matches := hostTokenRe.FindAllStringSubmatchIndex(raw, -1)
+
+	if len(matches) == 0 {
+		return p, nil
+	}
+
+	expr := strings.Builder{}
+	expr.WriteString("^")
+	n := 0
+
+	for i, match := range matches {
+		expr.WriteString(quoteHost(raw[n:match[0]]))
+
+		param := Param{name: raw[match[2]:match[3]], idx: i}
+
+		if match[4] >= 0 {
+			constraint := raw[match[4]:match[5]]
+
+			re, err := regexp.Compile(`^(?:` + constraint + `)$`)
+
+			if err != nil {
+				return nil, fmt.Errorf("bffurl.HostPattern: %s: %v", raw, err)
+			}
+
+			param.constraint = re
+		} else if match[1] < len(raw) && raw[match[1]] == '<' {
+			return nil, fmt.Errorf("bffurl.HostPattern: %s: unclosed constraint of %s", raw, param.RawName())
+		}
+
+		p.params = append(p.params, param)
+		expr.WriteString(fmt.Sprintf(`(?P<p%d>[^.]+)`, i))
+		n = match[1]
+	}
+
+	expr.WriteString(quoteHost(raw[n:]))
+	expr.WriteString("$")
+
+	p.re = regexp.MustCompile(expr.String())
+
+	return p, nil
+}
+
+// NewHostPattern parses a host pattern known to be valid, it panics on an
+// invalid one. Patterns from config are parsed with ParseHostPattern.
+func NewHostPattern(raw string) *HostPattern {
+	p, err := ParseHostPattern(raw)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return p
+}
+
+// quoteHost quotes the literal part of a host pattern, a `*` label matches any
+// label.
+func quoteHost(s string) string {
+	return strings.ReplaceAll(regexp.QuoteMeta(s), `\*`, `[^.]+`)
+}
+
+// Match returns whether the request host matches the pattern and records the
+// values of its params, nothing is recorded when it does not match.
+func (p *HostPattern) Match(r *http.Request) bool {
+	values, ok := p.capture(r.URL.Host)
+
+	if !ok {
+		return false
+	}
+
+	p.params.set(r, values)
+
+	return true
+}
+
+// capture returns the values of the params when host matches the pattern.
+func (p *HostPattern) capture(host string) ([]string, bool) {
+	if p.re == nil {
+		return nil, martianurl.MatchHost(host, p.raw)
+	}
+
+	match := p.re.FindStringSubmatch(host)
+
+	if match == nil {
+		return nil, false
+	}
+
+	values := make([]string, len(p.params))
+
+	for i, param := range p.params {
+		values[i] = match[p.re.SubexpIndex(fmt.Sprintf("p%d", param.idx))]
+
+		if param.constraint != nil && !param.constraint.MatchString(values[i]) {
+			return nil, false
+		}
+	}
+
+	return values, true
+}
+
+// HasParams returns whether the pattern captures any label.
+func (p *HostPattern) HasParams() bool {
+	return len(p.params) > 0
+}
+
+// ReplaceParams replaces the params of str with their values captured for the
+// request of ctx, constraints are dropped.
+func (p *HostPattern) ReplaceParams(ctx *martian.Context, str string) string {
+	values := make(map[string]string, len(p.params))
+
+	for _, param := range p.params {
+		values[param.name] = param.Get(ctx)
+	}
+
+	return hostTokenRe.ReplaceAllStringFunc(str, func(token string) string {
+		name := hostTokenRe.FindStringSubmatch(token)[1]
+
+		if value, ok := values[name]; ok {
+			return value
+		}
+
+		return token
+	})
+}
+
+// ParseURL parses a url whose host may be a host pattern, which url.Parse
+// rejects as an invalid port.
+func ParseURL(raw string) (*url.URL, error) {
+	i := strings.Index(raw, "://")
+
+	if i < 0 {
+		return url.Parse(raw)
+	}
+
+	rest := raw[i+3:]
+	j := strings.IndexAny(rest, "/?#")
+
+	if j < 0 {
+		j = len(rest)
+	}
+
+	host := rest[:j]
+
+	if strings.Contains(host, "@") || !hostTokenRe.MatchString(host) {
+		return url.Parse(raw)
+	}
+
+	if _, err := ParseHostPattern(host); err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(raw[:i+3] + "host.invalid" + rest[j:])
+
+	if err != nil {
+		return nil, err
+	}
+
+	u.Host = host
+
+	return u, nil
+}
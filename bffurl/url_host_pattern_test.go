@@ -0,0 +1,126 @@
+package bffurl
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/google/martian/v3"
+)
+
+func TestHostPatternMatch(t *testing.T) {
+	tt := []struct {
+		pattern string
+		host    string
+		want    bool
+		params  map[string]string
+	}{
+		{pattern: ":tenant.api.example.com", host: "acme.api.example.com", want: true, params: map[string]string{"tenant": "acme"}},
+		{pattern: ":tenant.api.example.com", host: "a.b.api.example.com", want: false},
+		{pattern: ":tenant.api.example.com", host: "api.example.com", want: false},
+		{pattern: ":tenant<[a-z]+>.api.example.com", host: "acme.api.example.com", want: true, params: map[string]string{"tenant": "acme"}},
+		{pattern: ":tenant<[a-z]+>.api.example.com", host: "acme1.api.example.com", want: false},
+		{pattern: ":tenant.:region.example.com", host: "acme.eu.example.com", want: true, params: map[string]string{"tenant": "acme", "region": "eu"}},
+		{pattern: ":tenant.example.com:8443", host: "acme.example.com:8443", want: true, params: map[string]string{"tenant": "acme"}},
+		{pattern: ":tenant.*.example.com", host: "acme.eu.example.com", want: true, params: map[string]string{"tenant": "acme"}},
+		{pattern: "*.example.com", host: "www.example.com", want: true},
+		{pattern: "example.com", host: "example.com", want: true},
+	}
+
+	for i, tc := range tt {
+		req, err := http.NewRequest("GET", "http://"+tc.host+"/", nil)
+		if err != nil {
+			t.Fatalf("%d. http.NewRequest(): got %v, want no error", i, err)
+		}
+
+		ctx, remove, err := martian.TestContext(req, nil, nil)
+		if err != nil {
+			t.Fatalf("%d. martian.TestContext(): got %v, want no error", i, err)
+		}
+
+		if got := NewHostPattern(tc.pattern).Match(req); got != tc.want {
+			t.Errorf("%d. NewHostPattern(%q).Match(%q): got %t, want %t", i, tc.pattern, tc.host, got, tc.want)
+		}
+
+		for name, want := range tc.params {
+			if got, _ := ctx.Get("bffurl.ParamName." + name); got != want {
+				t.Errorf("%d. param %s: got %q, want %q", i, name, got, want)
+			}
+		}
+
+		remove()
+	}
+}
+
+func TestModifierHostParams(t *testing.T) {
+	req, err := http.NewRequest("GET", "http://acme.api.example.com/users/42", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest(): got %v, want no error", err)
+	}
+
+	_, remove, err := martian.TestContext(req, nil, nil)
+	if err != nil {
+		t.Fatalf("martian.TestContext(): got %v, want no error", err)
+	}
+	defer remove()
+
+	f, err := NewFilter(mustParseURL(t, "http://:tenant<[a-z]+>.api.example.com/users/:id"))
+	if err != nil {
+		t.Fatalf("NewFilter(): got %v, want no error", err)
+	}
+
+	mod, err := NewModifier(mustParseURL(t, "http://:tenant.internal/:tenant/users/:id"))
+	if err != nil {
+		t.Fatalf("NewModifier(): got %v, want no error", err)
+	}
+
+	f.SetRequestModifier(mod)
+
+	if err := f.ModifyRequest(req); err != nil {
+		t.Fatalf("ModifyRequest(): got %v, want no error", err)
+	}
+
+	if got, want := req.URL.String(), "http://acme.internal/acme/users/42"; got != want {
+		t.Errorf("req.URL: got %q, want %q", got, want)
+	}
+	if got, want := req.Host, "acme.internal"; got != want {
+		t.Errorf("req.Host: got %q, want %q", got, want)
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	u, err := ParseURL("https://:tenant<[a-z]+>.api.example.com/v1/:id?q=1")
+	if err != nil {
+		t.Fatalf("ParseURL(): got %v, want no error", err)
+	}
+
+	if got, want := u.Host, ":tenant<[a-z]+>.api.example.com"; got != want {
+		t.Errorf("u.Host: got %q, want %q", got, want)
+	}
+	if got, want := u.Path, "/v1/:id"; got != want {
+		t.Errorf("u.Path: got %q, want %q", got, want)
+	}
+
+	if _, err := ParseURL("https://:tenant<[a-z>.api.example.com"); err == nil {
+		t.Error("ParseURL(): got no error, want error")
+	}
+}
+
+func mustParseURL(t *testing.T, raw string) *url.URL {
+	t.Helper()
+
+	u, err := ParseURL(raw)
+	if err != nil {
+		t.Fatalf("ParseURL(%q): got %v, want no error", raw, err)
+	}
+
+	return u
+}
+
+func TestParseHostPatternErrors(t *testing.T) {
+	for i, raw := range []string{":tenant<[a-z+>.example.com", ":tenant<[a-z]+.example.com"} {
+		if _, err := ParseHostPattern(raw); err == nil {
+			t.Errorf("%d. ParseHostPattern(%q): got no error, want error", i, raw)
+		}
+	}
+}
@@ -15,26 +15,66 @@
 package bffurl
 
 import (
+	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 
+	"github.com/google/martian/v3"
 	"github.com/google/martian/v3/log"
-	"github.com/google/martian/v3/martianurl"
 )
 
+const routeKey = "bffurl.Route"
+
 // Matcher is a conditional evaluator of request urls to be used in
 // filters that take conditionals.
 type Matcher struct {
 	url     *url.URL
 	pattern *Pattern
+	host    *HostPattern
+	query   []*Condition
+	headers []*Condition
 }
 
-// NewMatcher builds a new url matcher.
-func NewMatcher(url *url.URL) *Matcher {
+// NewMatcher builds a new url matcher, it fails on an invalid host or path
+// pattern.
+func NewMatcher(url *url.URL) (*Matcher, error) {
+	pattern, err := ParsePattern(url.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	host, err := ParseHostPattern(url.Host)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Matcher{
 		url:     url,
-		pattern: NewPattern(url.Path),
+		pattern: pattern,
+		host:    host,
+	}, nil
+}
+
+// AddQueryCondition adds a condition on the query params of the request, it
+// fails when the param is named like a path or host param.
+func (m *Matcher) AddQueryCondition(c *Condition) error {
+	for _, params := range []Params{m.pattern.params, m.host.params} {
+		for _, param := range params {
+			if param.name == c.name {
+				return fmt.Errorf("bffurl.Matcher: query param %q collides with the param %s of %s", c.name, param.RawName(), m.url)
+			}
+		}
 	}
+
+	m.query = append(m.query, c)
+
+	return nil
+}
+
+// AddHeaderCondition adds a condition on the headers of the request.
+func (m *Matcher) AddHeaderCondition(c *Condition) {
+	m.headers = append(m.headers, c)
 }
 
 // MatchRequest retuns true if all non-empty URL segments in m.url match the
@@ -44,11 +84,32 @@ func (m *Matcher) MatchRequest(req *http.Request) bool {
 
 	if matched {
 		log.Debugf("bffurl.Matcher.MatchRequest: matched: %s", m.url)
+
+		// the first matching path pattern names the route of the request
+		if ctx := martian.NewContext(req); ctx != nil && m.url.Path != "" {
+			if _, ok := ctx.Get(routeKey); !ok {
+				ctx.Set(routeKey, m.url.Path)
+			}
+		}
 	}
 
 	return matched
 }
 
+// Route returns the path pattern of the first matcher that matched the request,
+// or an empty string.
+func Route(ctx *martian.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	if route, ok := ctx.Get(routeKey); ok {
+		return route.(string)
+	}
+
+	return ""
+}
+
 // MatchResponse retuns true if all non-empty URL segments in m.url match the
 // request URL.
 func (m *Matcher) MatchResponse(res *http.Response) bool {
@@ -61,20 +122,103 @@ func (m *Matcher) MatchResponse(res *http.Response) bool {
 	return matched
 }
 
-// matches forces all non-empty URL segments to match or it returns false.
+// Compare compares the specificity of m and o, it returns a positive number
+// when m is more specific, a negative one when o is and 0 otherwise. Path
+// patterns are compared first, then a host beats no host, a host with params
+// beats a wildcard one and an exact host beats both.
+func (m *Matcher) Compare(o *Matcher) int {
+	if d := m.pattern.Compare(o.pattern); d != 0 {
+		return d
+	}
+
+	return m.hostRank() - o.hostRank()
+}
+
+func (m *Matcher) hostRank() int {
+	switch {
+	case m.url.Host == "":
+		return 0
+	case strings.HasPrefix(m.url.Host, "*."):
+		return 1
+	case m.host.HasParams():
+		return 2
+	default:
+		return 3
+	}
+}
+
+// Matches returns whether all non-empty URL segments in m.url match the request
+// URL, unlike MatchRequest it records neither the params nor the route.
+func (m *Matcher) Matches(req *http.Request) bool {
+	_, ok := m.capture(req)
+
+	return ok
+}
+
+// captured are the values of the params of a matching request.
+type captured struct {
+	host, path, query []string
+}
+
+// matches forces all non-empty URL segments to match or it returns false. The
+// params of the host and path patterns are only recorded when everything
+// matches, another matcher may be tried next.
 func (m *Matcher) matches(r *http.Request) bool {
+	values, ok := m.capture(r)
+
+	if !ok {
+		return false
+	}
+
+	m.host.params.set(r, values.host)
+	m.pattern.params.set(r, values.path)
+
+	for i, c := range m.query {
+		c.setQuery(r, values.query[i])
+	}
+
+	return true
+}
+
+// capture returns the values of the params when all non-empty URL segments
+// match, nothing is recorded.
+func (m *Matcher) capture(r *http.Request) (*captured, bool) {
+	var hostValues, pathValues []string
+
+	ok := true
+
+	if m.url.Host != "" {
+		hostValues, ok = m.host.capture(r.URL.Host)
+	}
+
+	if ok && m.url.Path != "" {
+		pathValues, ok = m.pattern.capture(r.URL.Path)
+	}
+
 	switch {
 	case m.url.Scheme != "" && m.url.Scheme != r.URL.Scheme:
-		return false
-	case m.url.Host != "" && !martianurl.MatchHost(r.URL.Host, m.url.Host):
-		return false
-	case m.url.Path != "" && !m.pattern.Match(r):
-		return false
-	case m.url.RawQuery != "" && m.url.RawQuery != r.URL.RawQuery:
-		return false
+		return nil, false
+	case !ok:
+		return nil, false
+	case m.url.RawQuery != "" && !containsQuery(r.URL.Query(), m.url.Query()):
+		return nil, false
 	case m.url.Fragment != "" && m.url.Fragment != r.URL.Fragment:
-		return false
+		return nil, false
 	}
 
-	return true
+	for _, c := range m.headers {
+		if !c.MatchHeader(r) {
+			return nil, false
+		}
+	}
+
+	queryValues := make([]string, len(m.query))
+
+	for i, c := range m.query {
+		if queryValues[i], ok = c.captureQuery(r); !ok {
+			return nil, false
+		}
+	}
+
+	return &captured{host: hostValues, path: pathValues, query: queryValues}, true
 }
@@ -32,6 +32,7 @@ import (
 type Modifier struct {
 	url     *url.URL
 	pattern *Pattern
+	host    *HostPattern
 }
 
 type modifierJSON struct {
@@ -52,8 +53,9 @@ func (m *Modifier) ModifyRequest(req *http.Request) error {
 		req.URL.Scheme = m.url.Scheme
 	}
 	if m.url.Host != "" {
-		req.URL.Host = m.url.Host
-		req.Host = m.url.Host
+		host := m.host.ReplaceParams(martian.NewContext(req), m.url.Host)
+		req.URL.Host = host
+		req.Host = host
 	}
 	if m.url.Path != "" {
 		ctx := martian.NewContext(req)
@@ -69,14 +71,26 @@ func (m *Modifier) ModifyRequest(req *http.Request) error {
 	return nil
 }
 
-// NewModifier overrides the url of the request.
-func NewModifier(u *url.URL) martian.RequestModifier {
+// NewModifier overrides the url of the request, it fails on an invalid host or
+// path pattern.
+func NewModifier(u *url.URL) (martian.RequestModifier, error) {
 	log.Debugf("bff.NewURLModifier: %s", u)
 
+	pattern, err := ParsePattern(u.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	host, err := ParseHostPattern(u.Host)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Modifier{
 		url:     u,
-		pattern: NewPattern(u.Path),
-	}
+		pattern: pattern,
+		host:    host,
+	}, nil
 }
 
 // modifierFromJSON builds a bffurl.Modifier from JSON.
@@ -97,12 +111,15 @@ func modifierFromJSON(b []byte) (*parse.Result, error) {
 		return nil, err
 	}
 
-	mod := NewModifier(&url.URL{
+	mod, err := NewModifier(&url.URL{
 		Scheme:   msg.Scheme,
 		Host:     msg.Host,
 		Path:     msg.Path,
 		RawQuery: msg.Query,
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	return parse.NewResult(mod, msg.Scope)
 }
@@ -66,7 +66,10 @@ func TestNewModifier(t *testing.T) {
 			t.Fatalf("%d. NewRequest(): got %v, want no error", i, err)
 		}
 
-		mod := NewModifier(tc.url)
+		mod, err := NewModifier(tc.url)
+		if err != nil {
+			t.Fatalf("%d. NewModifier(): got %v, want no error", i, err)
+		}
 
 		if err := mod.ModifyRequest(req); err != nil {
 			t.Fatalf("%d. ModifyRequest(): got %q, want no error", i, err)
@@ -91,7 +94,10 @@ func TestIntegration(t *testing.T) {
 		Scheme: "http",
 		Host:   server.Listener.Addr().String(),
 	}
-	m := NewModifier(u)
+	m, err := NewModifier(u)
+	if err != nil {
+		t.Fatalf("NewModifier(): got %v, want no error", err)
+	}
 
 	req, err := http.NewRequest("GET", "https://example.com/test", nil)
 	if err != nil {
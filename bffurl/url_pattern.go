@@ -26,15 +26,23 @@ import (
 	"fmt"
 	"net/http"
 	"regexp"
-	"sort"
 	"strings"
 
 	"github.com/google/martian/v3"
 )
 
-var patternRe = regexp.MustCompile(`[/.;,]:([^/.;,]+)`)
-
-// Pattern WIP
+// tokenRe matches a param along with the delimiter before it: `:name`, with an
+// optional `<regex>` constraint and a trailing `?` when the segment is
+// optional, or a `*name` catch-all ending the pattern.
+var tokenRe = regexp.MustCompile(`[/.;,](?::([^/.;,<>?*]+)(?:<([^>]*)>)?(\?)?|\*([^/.;,<>?*]+)$)`)
+
+// Pattern is a path pattern, its params capture the matching parts of the
+// request path into the martian context.
+//
+//	/users/:id           :id captures a segment, or up to the next delimiter
+//	/users/:id<[0-9]+>   the segment must match the regex
+//	/users/:id?          the segment may be missing, /users matches
+//	/api/v1/*rest        *rest captures the remainder of the path
 type Pattern struct {
 	raw      string
 	prefixes []string
@@ -42,23 +50,30 @@ type Pattern struct {
 	breaks   []byte
 }
 
-// Param WIP
+// Param is a named capture of a Pattern.
 type Param struct {
-	name string
-	idx  int
+	name       string
+	idx        int
+	constraint *regexp.Regexp
+	optional   bool
+	catchAll   bool
 }
 
-// RawName WIP
+// RawName returns the param as written in a pattern, without constraint.
 func (p *Param) RawName() string {
+	if p.catchAll {
+		return fmt.Sprintf("*%s", p.name)
+	}
+
 	return fmt.Sprintf(":%s", p.name)
 }
 
-// Name WIP
+// Name returns the martian context key of the param.
 func (p *Param) Name() string {
 	return `bffurl.ParamName.` + p.name
 }
 
-// Get WIP
+// Get returns the value of the param captured for the request of ctx.
 func (p *Param) Get(ctx *martian.Context) string {
 	if val, ok := ctx.Get(p.Name()); ok {
 		return val.(string)
@@ -67,32 +82,27 @@ func (p *Param) Get(ctx *martian.Context) string {
 	return ""
 }
 
-// Set WIP
+// Set records the value of the param for req.
 func (p *Param) Set(req *http.Request, value string) {
 	ctx := martian.NewContext(req)
 	ctx.Set(p.Name(), value)
 }
 
-// Params WIP
+// Params are the params of a Pattern in the order they appear.
 type Params []Param
 
-func (p Params) Len() int {
-	return len(p)
-}
-
-func (p Params) Less(i, j int) bool {
-	return p[i].name < p[j].name
-}
-
-func (p Params) Swap(i, j int) {
-	p[i], p[j] = p[j], p[i]
+// set records the captured values of the params for req.
+func (ps Params) set(req *http.Request, values []string) {
+	for i, param := range ps {
+		param.Set(req, values[i])
+	}
 }
 
-// NewPattern WIP
-func NewPattern(raw string) *Pattern {
+// ParsePattern parses a path pattern, it fails on an invalid constraint.
+func ParsePattern(raw string) (*Pattern, error) {
 	p := &Pattern{raw: raw}
 
-	matches := patternRe.FindAllStringIndex(raw, -1)
+	matches := tokenRe.FindAllStringSubmatchIndex(raw, -1)
 	matchesLen := len(matches)
 
 	p.params = make(Params, matchesLen)
@@ -103,10 +113,34 @@ func NewPattern(raw string) *Pattern {
 
 	for i, match := range matches {
 		start, end := match[0], match[1]
+		param := &p.params[i]
 
 		p.prefixes[i] = raw[n : start+1]
-		p.params[i].name = raw[start+2 : end]
-		p.params[i].idx = i
+		param.idx = i
+
+		if match[8] >= 0 {
+			param.name = raw[match[8]:match[9]]
+			param.catchAll = true
+		} else {
+			param.name = raw[match[2]:match[3]]
+			param.optional = match[6] >= 0
+
+			if match[4] >= 0 {
+				re, err := regexp.Compile(`^(?:` + raw[match[4]:match[5]] + `)$`)
+
+				if err != nil {
+					return nil, fmt.Errorf("bffurl.Pattern: %s: %v", raw, err)
+				}
+
+				param.constraint = re
+			} else if end < len(raw) && raw[end] == '<' {
+				return nil, fmt.Errorf("bffurl.Pattern: %s: unclosed constraint of %s", raw, param.RawName())
+			}
+		}
+
+		if param.optional && (raw[start] != '/' || end < len(raw) && raw[end] != '/') {
+			return nil, fmt.Errorf("bffurl.Pattern: %s: optional param %s must be a whole segment", raw, param.RawName())
+		}
 
 		if end == len(raw) {
 			p.breaks[i] = '/'
@@ -119,53 +153,189 @@ func NewPattern(raw string) *Pattern {
 
 	p.prefixes[matchesLen] = raw[n:]
 
-	sort.Sort(p.params)
+	return p, nil
+}
+
+// NewPattern parses a path pattern known to be valid, it panics on an invalid
+// one. Patterns from config are parsed with ParsePattern.
+func NewPattern(raw string) *Pattern {
+	p, err := ParsePattern(raw)
+
+	if err != nil {
+		panic(err)
+	}
 
 	return p
 }
 
-// ReplaceParams WIP
+// ReplaceParams replaces the params of the pattern in str with their values
+// captured for the request of ctx. A missing optional segment or an empty
+// catch-all is removed along with the delimiter before it.
 func (p *Pattern) ReplaceParams(ctx *martian.Context, str string) string {
+	values := make(map[string]string, len(p.params))
+
 	for _, param := range p.params {
-		str = strings.ReplaceAll(str, param.RawName(), param.Get(ctx))
+		values[param.RawName()] = param.Get(ctx)
 	}
 
-	return str
+	return tokenRe.ReplaceAllStringFunc(str, func(token string) string {
+		match := tokenRe.FindStringSubmatch(token)
+
+		raw := ":" + match[1]
+		skippable := match[3] != ""
+
+		if match[4] != "" {
+			raw, skippable = "*"+match[4], true
+		}
+
+		value, ok := values[raw]
+
+		if !ok {
+			return token
+		}
+
+		if value == "" && skippable {
+			return ""
+		}
+
+		return token[:1] + value
+	})
 }
 
-// Match WIP
+// Match returns whether the request path matches the pattern and records the
+// captured params, nothing is recorded when it does not match.
 func (p *Pattern) Match(r *http.Request) bool {
-	path := r.URL.Path
+	values, ok := p.capture(r.URL.Path)
+
+	if !ok {
+		return false
+	}
 
-	for i, param := range p.params {
-		prefix := p.prefixes[i]
+	p.params.set(r, values)
 
-		if !strings.HasPrefix(path, prefix) {
-			return false
-		}
+	return true
+}
+
+// capture returns the values of the params when path matches the pattern.
+func (p *Pattern) capture(path string) ([]string, bool) {
+	values := make([]string, len(p.params))
+
+	return values, p.match(path, 0, values)
+}
+
+// match matches path against the pattern from the param i on. An optional
+// segment or a catch-all is tried present first, then missing, so that
+// /users/:id?/posts matches /users/posts.
+func (p *Pattern) match(path string, i int, values []string) bool {
+	if i == len(p.params) {
+		return path == p.prefixes[i]
+	}
+
+	param := p.params[i]
+	prefix := p.prefixes[i]
 
-		path = path[len(prefix):]
+	if strings.HasPrefix(path, prefix) {
+		rest := path[len(prefix):]
+
+		if param.catchAll {
+			values[i] = rest
+			return true
+		}
 
 		brk := p.breaks[i]
 		n := 0
 
-		for n < len(path) {
-			if path[n] == brk || path[n] == '/' {
+		for n < len(rest) {
+			if rest[n] == brk || rest[n] == '/' {
 				break
 			}
 
 			n++
 		}
 
-		if n == 0 {
-			return false
+		if (n > 0 || param.optional) && (n == 0 || param.constraint == nil || param.constraint.MatchString(rest[:n])) {
+			values[i] = rest[:n]
+
+			if p.match(rest[n:], i+1, values) {
+				return true
+			}
+		}
+	}
+
+	if param.catchAll || param.optional {
+		// the segment, and the slash before it, may be missing
+		base := prefix[:len(prefix)-1]
+
+		if strings.HasPrefix(path, base) && (len(path) == len(base) || path[len(base)] == '/') {
+			values[i] = ""
+
+			return p.match(path[len(base):], i+1, values)
+		}
+	}
+
+	return false
+}
+
+// segment ranks, a missing segment ranks between a param and an optional one
+// so that /users is preferred over /users/:id? and /a/:b over /a/:b/*rest
+const (
+	rankCatchAll    = 0
+	rankOptional    = 2
+	rankMissing     = 3
+	rankParam       = 4
+	rankConstrained = 6
+	rankMixed       = 8
+	rankLiteral     = 10
+)
+
+// Compare compares the specificity of p and q, it returns a positive number
+// when p is more specific, a negative one when q is and 0 otherwise. Segments
+// are compared from the left: a literal segment, one mixing text and params, a
+// constrained param, a param, an optional param and a catch-all, from the most
+// to the least specific.
+func (p *Pattern) Compare(q *Pattern) int {
+	ps, qs := p.segmentRanks(), q.segmentRanks()
+
+	for i := 0; i < len(ps) || i < len(qs); i++ {
+		pr, qr := rankMissing, rankMissing
+
+		if i < len(ps) {
+			pr = ps[i]
+		}
+
+		if i < len(qs) {
+			qr = qs[i]
 		}
 
-		param.Set(r, path[:n])
-		path = path[n:]
+		if d := pr - qr; d != 0 {
+			return d
+		}
 	}
 
-	tail := p.prefixes[len(p.params)]
+	return 0
+}
+
+func (p *Pattern) segmentRanks() []int {
+	var ranks []int
+
+	for _, segment := range strings.Split(p.raw, "/") {
+		tokens := tokenRe.FindAllStringSubmatch("/"+segment, -1)
+
+		switch {
+		case len(tokens) == 0:
+			ranks = append(ranks, rankLiteral)
+		case len(tokens) > 1 || len(tokens[0][0]) != len(segment)+1:
+			ranks = append(ranks, rankMixed)
+		case tokens[0][4] != "":
+			ranks = append(ranks, rankCatchAll)
+		case tokens[0][3] != "":
+			ranks = append(ranks, rankOptional)
+		case tokens[0][2] != "":
+			ranks = append(ranks, rankConstrained)
+		default:
+			ranks = append(ranks, rankParam)
+		}
+	}
 
-	return path == tail
+	return ranks
 }
@@ -0,0 +1,174 @@
+package bffurl
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/martian/v3"
+)
+
+func TestPatternMatch(t *testing.T) {
+	tt := []struct {
+		pattern string
+		path    string
+		want    bool
+		params  map[string]string
+	}{
+		{pattern: "/users/:id", path: "/users/42", want: true, params: map[string]string{"id": "42"}},
+		{pattern: "/users/:id", path: "/users", want: false},
+		{pattern: "/users/:id<[0-9]+>", path: "/users/42", want: true, params: map[string]string{"id": "42"}},
+		{pattern: "/users/:id<[0-9]+>", path: "/users/me", want: false},
+		{pattern: "/files/:name.:ext<json|yaml>", path: "/files/config.yaml", want: true, params: map[string]string{"name": "config", "ext": "yaml"}},
+		{pattern: "/files/:name.:ext<json|yaml>", path: "/files/config.toml", want: false},
+		{pattern: "/users/:id?", path: "/users/42", want: true, params: map[string]string{"id": "42"}},
+		{pattern: "/users/:id?", path: "/users", want: true, params: map[string]string{"id": ""}},
+		{pattern: "/users/:id?/posts", path: "/users/posts", want: true, params: map[string]string{"id": ""}},
+		{pattern: "/users/:id?/posts", path: "/users/42/comments", want: false},
+		{pattern: "/a/:x?/:y", path: "/a/b", want: true, params: map[string]string{"x": "", "y": "b"}},
+		{pattern: "/a/:x?/:y", path: "/a/b/c", want: true, params: map[string]string{"x": "b", "y": "c"}},
+		{pattern: "/users/:id?/posts", path: "/users/42/posts", want: true, params: map[string]string{"id": "42"}},
+		{pattern: "/api/v1/*rest", path: "/api/v1/users/42", want: true, params: map[string]string{"rest": "users/42"}},
+		{pattern: "/api/v1/*rest", path: "/api/v1", want: true, params: map[string]string{"rest": ""}},
+		{pattern: "/api/v1/*rest", path: "/api/v10", want: false},
+		{pattern: "/:b/:a", path: "/x/y", want: true, params: map[string]string{"b": "x", "a": "y"}},
+	}
+
+	for i, tc := range tt {
+		req, err := http.NewRequest("GET", "http://example.com"+tc.path, nil)
+		if err != nil {
+			t.Fatalf("%d. http.NewRequest(): got %v, want no error", i, err)
+		}
+
+		ctx, remove, err := martian.TestContext(req, nil, nil)
+		if err != nil {
+			t.Fatalf("%d. martian.TestContext(): got %v, want no error", i, err)
+		}
+
+		if got := NewPattern(tc.pattern).Match(req); got != tc.want {
+			t.Errorf("%d. NewPattern(%q).Match(%q): got %t, want %t", i, tc.pattern, tc.path, got, tc.want)
+		}
+
+		for name, want := range tc.params {
+			if got, _ := ctx.Get("bffurl.ParamName." + name); got != want {
+				t.Errorf("%d. param %s: got %q, want %q", i, name, got, want)
+			}
+		}
+
+		remove()
+	}
+}
+
+func TestMatcherRecordsNothingOnMismatch(t *testing.T) {
+	tt := []struct {
+		url  string
+		path string
+	}{
+		{url: "/users/:id/posts", path: "/users/42/comments"},
+		{url: "/users/:id?/posts", path: "/users/42"},
+		{url: "http://:id.example.com/users", path: "/posts"},
+		{url: "/users/:id?a=b", path: "/users/42"},
+	}
+
+	for i, tc := range tt {
+		req, err := http.NewRequest("GET", "http://acme.example.com"+tc.path, nil)
+		if err != nil {
+			t.Fatalf("%d. http.NewRequest(): got %v, want no error", i, err)
+		}
+
+		ctx, remove, err := martian.TestContext(req, nil, nil)
+		if err != nil {
+			t.Fatalf("%d. martian.TestContext(): got %v, want no error", i, err)
+		}
+
+		u, err := ParseURL(tc.url)
+		if err != nil {
+			t.Fatalf("%d. ParseURL(%q): got %v, want no error", i, tc.url, err)
+		}
+
+		m, err := NewMatcher(u)
+		if err != nil {
+			t.Fatalf("%d. NewMatcher(): got %v, want no error", i, err)
+		}
+
+		if m.MatchRequest(req) {
+			t.Errorf("%d. MatchRequest(%q): got true, want false", i, tc.path)
+		}
+		if got, ok := ctx.Get("bffurl.ParamName.id"); ok {
+			t.Errorf("%d. param id: got %q, want unset", i, got)
+		}
+
+		remove()
+	}
+}
+
+func TestPatternReplaceParams(t *testing.T) {
+	tt := []struct {
+		match   string
+		path    string
+		replace string
+		want    string
+	}{
+		{match: "/api/v1/*rest", path: "/api/v1/users/42", replace: "/v1/*rest", want: "/v1/users/42"},
+		{match: "/api/v1/*rest", path: "/api/v1", replace: "/v1/*rest", want: "/v1"},
+		{match: "/users/:id<[0-9]+>", path: "/users/42", replace: "/people/:id<[0-9]+>", want: "/people/42"},
+		{match: "/users/:id?", path: "/users", replace: "/people/:id?", want: "/people"},
+		{match: "/users/:id/:idx", path: "/users/1/2", replace: "/u/:idx/:id", want: "/u/2/1"},
+	}
+
+	for i, tc := range tt {
+		req, err := http.NewRequest("GET", "http://example.com"+tc.path, nil)
+		if err != nil {
+			t.Fatalf("%d. http.NewRequest(): got %v, want no error", i, err)
+		}
+
+		ctx, remove, err := martian.TestContext(req, nil, nil)
+		if err != nil {
+			t.Fatalf("%d. martian.TestContext(): got %v, want no error", i, err)
+		}
+
+		if !NewPattern(tc.match).Match(req) {
+			t.Fatalf("%d. NewPattern(%q).Match(%q): got false, want true", i, tc.match, tc.path)
+		}
+
+		if got := NewPattern(tc.replace).ReplaceParams(ctx, tc.replace); got != tc.want {
+			t.Errorf("%d. ReplaceParams(%q): got %q, want %q", i, tc.replace, got, tc.want)
+		}
+
+		remove()
+	}
+}
+
+func TestPatternCompare(t *testing.T) {
+	tt := []struct {
+		more string
+		less string
+	}{
+		{more: "/users/me", less: "/users/:id"},
+		{more: "/users/:id<[0-9]+>", less: "/users/:id"},
+		{more: "/users/:id.json", less: "/users/:id"},
+		{more: "/users/:id", less: "/users/:id?"},
+		{more: "/users", less: "/users/:id?"},
+		{more: "/users/:id", less: "/users/*rest"},
+		{more: "/api/:v", less: "/api/:v/*rest"},
+		{more: "/api/v1/*rest", less: "/api/*rest"},
+	}
+
+	for i, tc := range tt {
+		more, less := NewPattern(tc.more), NewPattern(tc.less)
+
+		if got := more.Compare(less); got <= 0 {
+			t.Errorf("%d. NewPattern(%q).Compare(%q): got %d, want > 0", i, tc.more, tc.less, got)
+		}
+		if got := less.Compare(more); got >= 0 {
+			t.Errorf("%d. NewPattern(%q).Compare(%q): got %d, want < 0", i, tc.less, tc.more, got)
+		}
+	}
+}
+
+func TestParsePatternErrors(t *testing.T) {
+	for i, raw := range []string{"/users/:id<[0-9+>", "/users/:id<[0-9]+", "/users/:id<[0-9]+/posts", "/users/:id?x", "/users.:id?", "/users/:id?.json"} {
+		if _, err := ParsePattern(raw); err == nil {
+			t.Errorf("%d. ParsePattern(%q): got no error, want error", i, raw)
+		}
+	}
+}
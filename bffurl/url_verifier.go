@@ -52,15 +52,20 @@ type verifierJSON struct {
 	Scope  []parse.ModifierType `json:"scope"`
 }
 
-// NewVerifier returns a new URL verifier.
-func NewVerifier(u *url.URL) verify.RequestVerifier {
+// NewVerifier returns a new URL verifier, it fails on an invalid path pattern.
+func NewVerifier(u *url.URL) (verify.RequestVerifier, error) {
 	log.Debugf("bff.NewURLVerifier: %s", u)
 
+	pattern, err := ParsePattern(u.Path)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Verifier{
 		url:     u,
 		err:     martian.NewMultiError(),
-		pattern: NewPattern(u.Path),
-	}
+		pattern: pattern,
+	}, nil
 }
 
 // ModifyRequest verifies that the request URL matches all parts of url. If the
@@ -138,12 +143,15 @@ func verifierFromJSON(b []byte) (*parse.Result, error) {
 		return nil, err
 	}
 
-	v := NewVerifier(&url.URL{
+	v, err := NewVerifier(&url.URL{
 		Scheme:   msg.Scheme,
 		Host:     msg.Host,
 		Path:     msg.Path,
 		RawQuery: msg.Query,
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	return parse.NewResult(v, msg.Scope)
 }
@@ -32,7 +32,10 @@ func TestVerifyRequests(t *testing.T) {
 		RawQuery: "testing=true",
 		Fragment: "test",
 	}
-	v := NewVerifier(u)
+	v, err := NewVerifier(u)
+	if err != nil {
+		t.Fatalf("NewVerifier(): got %v, want no error", err)
+	}
 
 	tt := []struct {
 		got, want string
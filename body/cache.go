@@ -0,0 +1,376 @@
+package body
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/martian/v3/log"
+)
+
+const defaultCacheSize = 1000
+
+// heuristically cacheable status codes, see RFC 7231 section 6.1
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// ResourceCache is an in-memory LRU cache of upstream responses. Responses are
+// kept for ttl, or as long as their Cache-Control or Expires headers allow
+// when ttl is zero, and served stale for staleWhileRevalidate while they are
+// refreshed in the background. Responses marked no-store or private are never
+// cached. Concurrent misses for the same key are coalesced into a single
+// upstream request.
+type ResourceCache struct {
+	size                 int
+	ttl                  time.Duration
+	staleWhileRevalidate time.Duration
+	keyHeaders           []string
+
+	mu         sync.Mutex
+	generation int64
+	entries    map[string]*list.Element
+	lru        *list.List
+	flights    flightGroup
+}
+
+type cacheEntry struct {
+	key        string
+	status     int
+	header     http.Header
+	body       []byte
+	expires    time.Time
+	staleUntil time.Time
+}
+
+// NewResourceCache returns a ResourceCache holding up to size responses, keyed
+// by method, URL, body and the values of keyHeaders.
+func NewResourceCache(size int, ttl, staleWhileRevalidate time.Duration, keyHeaders []string) *ResourceCache {
+	if size <= 0 {
+		size = defaultCacheSize
+	}
+
+	return &ResourceCache{
+		size:                 size,
+		ttl:                  ttl,
+		staleWhileRevalidate: staleWhileRevalidate,
+		keyHeaders:           keyHeaders,
+		generation:           currentGeneration(),
+		entries:              make(map[string]*list.Element),
+		lru:                  list.New(),
+	}
+}
+
+// roundTrip serves req from the cache or through send.
+func (c *ResourceCache) roundTrip(req *http.Request, payload []byte, send func(*http.Request, []byte) (*http.Response, error)) (*http.Response, error) {
+	key := c.key(req, payload)
+	now := time.Now()
+
+	fetch := func(req *http.Request) func() (*cacheEntry, error) {
+		return func() (*cacheEntry, error) {
+			res, err := send(req, payload)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return c.store(key, res, time.Now())
+		}
+	}
+
+	if entry := c.get(key); entry != nil {
+		if now.Before(entry.expires) {
+			log.Debugf("body.JSONResource.Cache: hit url(%s)", req.URL)
+			return entry.response(req), nil
+		}
+
+		if now.Before(entry.staleUntil) {
+			log.Debugf("body.JSONResource.Cache: stale url(%s)", req.URL)
+
+			// the revalidation outlives the downstream request
+			revalidate := fetch(req.Clone(detach(req.Context())))
+
+			go func() {
+				if _, err, _ := c.flights.do(context.Background(), key, revalidate); err != nil {
+					log.Errorf("body.JSONResource.Cache: revalidate url(%s): %v", req.URL, err)
+				}
+			}()
+
+			return entry.response(req), nil
+		}
+	}
+
+	log.Debugf("body.JSONResource.Cache: miss url(%s)", req.URL)
+
+	// the fetch is shared with the concurrent misses, it outlives the
+	// downstream request that started it
+	entry, err, _ := c.flights.do(req.Context(), key, fetch(req.Clone(detach(req.Context()))))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return entry.response(req), nil
+}
+
+func (c *ResourceCache) key(req *http.Request, payload []byte) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s %s\n", req.Method, req.URL)
+
+	headers := append([]string{}, c.keyHeaders...)
+	sort.Strings(headers)
+
+	for _, header := range headers {
+		fmt.Fprintf(&b, "%q: %q\n", http.CanonicalHeaderKey(header), req.Header.Values(header))
+	}
+
+	if len(payload) > 0 {
+		sum := sha256.Sum256(payload)
+		b.WriteString(hex.EncodeToString(sum[:]))
+	}
+
+	return b.String()
+}
+
+func (c *ResourceCache) get(key string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sync()
+
+	el, ok := c.entries[key]
+
+	if !ok {
+		return nil
+	}
+
+	c.lru.MoveToFront(el)
+
+	return el.Value.(*cacheEntry)
+}
+
+// store snapshots res and caches it when it is cacheable.
+func (c *ResourceCache) store(key string, res *http.Response, now time.Time) (*cacheEntry, error) {
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &cacheEntry{
+		key:    key,
+		status: res.StatusCode,
+		header: res.Header.Clone(),
+		body:   body,
+	}
+
+	ttl, swr, ok := c.freshness(res, now)
+
+	if !ok || !cacheableStatus[res.StatusCode] {
+		return entry, nil
+	}
+
+	entry.expires = now.Add(ttl)
+	entry.staleUntil = entry.expires.Add(swr)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sync()
+
+	if el, ok := c.entries[key]; ok {
+		el.Value = entry
+		c.lru.MoveToFront(el)
+		return entry, nil
+	}
+
+	c.entries[key] = c.lru.PushFront(entry)
+
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+
+	return entry, nil
+}
+
+// sync drops the entries cached before the last Reset, c.mu must be held.
+func (c *ResourceCache) sync() {
+	if gen := currentGeneration(); c.generation != gen {
+		c.generation = gen
+		c.entries = make(map[string]*list.Element)
+		c.lru.Init()
+	}
+}
+
+// freshness returns how long res stays fresh and can then be served stale,
+// the configured ttl takes precedence over the response headers except for
+// no-store and private, which are never cached.
+func (c *ResourceCache) freshness(res *http.Response, now time.Time) (time.Duration, time.Duration, bool) {
+	directives := parseCacheControl(res.Header.Get("Cache-Control"))
+
+	for _, directive := range []string{"no-store", "private"} {
+		if _, ok := directives[directive]; ok {
+			return 0, 0, false
+		}
+	}
+
+	swr := c.staleWhileRevalidate
+
+	if swr == 0 {
+		if secs, err := strconv.Atoi(directives["stale-while-revalidate"]); err == nil {
+			swr = time.Duration(secs) * time.Second
+		}
+	}
+
+	if c.ttl > 0 {
+		return c.ttl, swr, true
+	}
+
+	if _, ok := directives["no-cache"]; ok {
+		return 0, 0, false
+	}
+
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		if secs, err := strconv.Atoi(directives[directive]); err == nil && secs > 0 {
+			return time.Duration(secs) * time.Second, swr, true
+		}
+	}
+
+	if expires, err := http.ParseTime(res.Header.Get("Expires")); err == nil {
+		date, err := http.ParseTime(res.Header.Get("Date"))
+
+		if err != nil {
+			date = now
+		}
+
+		if ttl := expires.Sub(date); ttl > 0 {
+			return ttl, swr, true
+		}
+	}
+
+	return 0, 0, false
+}
+
+func parseCacheControl(header string) map[string]string {
+	directives := make(map[string]string)
+
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+
+		if part == "" {
+			continue
+		}
+
+		name, value := part, ""
+
+		if i := strings.IndexByte(part, '='); i >= 0 {
+			name, value = part[:i], strings.Trim(part[i+1:], `"`)
+		}
+
+		directives[strings.ToLower(name)] = value
+	}
+
+	return directives
+}
+
+func (e *cacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.status, http.StatusText(e.status)),
+		StatusCode:    e.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}
+}
+
+// flightGroup coalesces concurrent calls with the same key into one.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+}
+
+type flight struct {
+	done  chan struct{}
+	entry *cacheEntry
+	err   error
+}
+
+// do runs fn once for all the concurrent callers of key, shared reports
+// whether the result came from another caller. fn runs on its own, a caller
+// whose ctx is done stops waiting for it without failing the others.
+func (g *flightGroup) do(ctx context.Context, key string, fn func() (*cacheEntry, error)) (entry *cacheEntry, err error, shared bool) {
+	g.mu.Lock()
+
+	if g.calls == nil {
+		g.calls = make(map[string]*flight)
+	}
+
+	f, shared := g.calls[key]
+
+	if !shared {
+		f = &flight{done: make(chan struct{})}
+		g.calls[key] = f
+
+		go func() {
+			f.entry, f.err = fn()
+
+			g.mu.Lock()
+			delete(g.calls, key)
+			g.mu.Unlock()
+
+			close(f.done)
+		}()
+	}
+
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.entry, f.err, shared
+	case <-ctx.Done():
+		return nil, ctx.Err(), shared
+	}
+}
+
+// detachedContext keeps the values of a context without its deadline and
+// cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// detach returns a context with the values of ctx that is never canceled, for
+// the fetches shared by several requests.
+func detach(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
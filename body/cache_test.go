@@ -0,0 +1,342 @@
+package body
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/martian/v3/parse"
+	"github.com/google/martian/v3/proxyutil"
+)
+
+// countingSend answers with the body and Cache-Control of the current call
+// number.
+func countingSend(calls *int64, cacheControl string) func(*http.Request, []byte) (*http.Response, error) {
+	return func(req *http.Request, payload []byte) (*http.Response, error) {
+		n := atomic.AddInt64(calls, 1)
+		res := proxyutil.NewResponse(200, bytes.NewReader([]byte{byte('0' + n)}), req)
+		res.Header.Set("Cache-Control", cacheControl)
+
+		return res, nil
+	}
+}
+
+func newCacheRequest(t *testing.T, url string, headers map[string]string) *http.Request {
+	t.Helper()
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest(): got %v, want no error", err)
+	}
+
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	return req
+}
+
+func readBody(t *testing.T, res *http.Response) string {
+	t.Helper()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("ioutil.ReadAll(): got %v, want no error", err)
+	}
+
+	return string(b)
+}
+
+func TestResourceCacheKey(t *testing.T) {
+	c := NewResourceCache(0, time.Minute, 0, []string{"Authorization", "X-Tenant"})
+	base := c.key(newCacheRequest(t, "http://example.com/user", map[string]string{"Authorization": "Bearer alice"}), nil)
+
+	tt := []struct {
+		url     string
+		headers map[string]string
+		payload string
+		same    bool
+	}{
+		{url: "http://example.com/user", headers: map[string]string{"Authorization": "Bearer alice"}, same: true},
+		{url: "http://example.com/user", headers: map[string]string{"Authorization": "Bearer alice", "Traceparent": "00-1-2-01"}, same: true},
+		{url: "http://example.com/user", headers: map[string]string{"Authorization": "Bearer alice", "User-Agent": "curl"}, same: true},
+		{url: "http://example.com/user", headers: map[string]string{"Authorization": "Bearer bob"}},
+		{url: "http://example.com/user", headers: map[string]string{"Authorization": "Bearer alice", "X-Tenant": "acme"}},
+		{url: "http://example.com/user"},
+		{url: "http://example.com/user?page=2", headers: map[string]string{"Authorization": "Bearer alice"}},
+		{url: "http://example.com/user", headers: map[string]string{"Authorization": "Bearer alice"}, payload: `{}`},
+	}
+
+	for i, tc := range tt {
+		got := c.key(newCacheRequest(t, tc.url, tc.headers), []byte(tc.payload))
+
+		if same := got == base; same != tc.same {
+			t.Errorf("%d. key(%s, %v, %q) == base: got %t, want %t", i, tc.url, tc.headers, tc.payload, same, tc.same)
+		}
+	}
+}
+
+func TestResourceCacheCredentials(t *testing.T) {
+	var calls int64
+	c := NewResourceCache(0, time.Minute, 0, []string{"Authorization"})
+	send := countingSend(&calls, "")
+
+	for i, user := range []string{"alice", "bob", "alice"} {
+		req := newCacheRequest(t, "http://example.com/user", map[string]string{"Authorization": "Bearer " + user})
+
+		if _, err := c.roundTrip(req, nil, send); err != nil {
+			t.Fatalf("%d. roundTrip(%s): got %v, want no error", i, user, err)
+		}
+	}
+
+	if got, want := atomic.LoadInt64(&calls), int64(2); got != want {
+		t.Errorf("calls: got %d, want %d", got, want)
+	}
+}
+
+func TestResourceCacheEviction(t *testing.T) {
+	var calls int64
+	c := NewResourceCache(2, time.Minute, 0, nil)
+	send := countingSend(&calls, "")
+
+	for i, path := range []string{"/a", "/b", "/a", "/c", "/a", "/b"} {
+		if _, err := c.roundTrip(newCacheRequest(t, "http://example.com"+path, nil), nil, send); err != nil {
+			t.Fatalf("%d. roundTrip(%s): got %v, want no error", i, path, err)
+		}
+	}
+
+	// /a is used again before /c is stored, so /b is evicted in its place
+	if got, want := atomic.LoadInt64(&calls), int64(4); got != want {
+		t.Errorf("calls: got %d, want %d", got, want)
+	}
+	if got, want := c.lru.Len(), 2; got != want {
+		t.Errorf("c.lru.Len(): got %d, want %d", got, want)
+	}
+}
+
+func TestResourceCacheUncacheable(t *testing.T) {
+	for i, cacheControl := range []string{"no-store", "private, max-age=60"} {
+		var calls int64
+		c := NewResourceCache(0, time.Minute, 0, nil)
+		send := countingSend(&calls, cacheControl)
+
+		for n := 0; n < 2; n++ {
+			if _, err := c.roundTrip(newCacheRequest(t, "http://example.com/user", nil), nil, send); err != nil {
+				t.Fatalf("%d. roundTrip(): got %v, want no error", i, err)
+			}
+		}
+
+		if got, want := atomic.LoadInt64(&calls), int64(2); got != want {
+			t.Errorf("%d. %s: calls: got %d, want %d", i, cacheControl, got, want)
+		}
+	}
+}
+
+func TestResourceCacheStaleWhileRevalidate(t *testing.T) {
+	var calls int64
+	c := NewResourceCache(0, time.Millisecond, time.Hour, nil)
+
+	revalidated := make(chan struct{}, 1)
+	send := func(req *http.Request, payload []byte) (*http.Response, error) {
+		res, err := countingSend(&calls, "")(req, payload)
+
+		if atomic.LoadInt64(&calls) > 1 {
+			revalidated <- struct{}{}
+		}
+
+		return res, err
+	}
+
+	res, err := c.roundTrip(newCacheRequest(t, "http://example.com/user", nil), nil, send)
+	if err != nil {
+		t.Fatalf("roundTrip(): got %v, want no error", err)
+	}
+	if got, want := readBody(t, res), "1"; got != want {
+		t.Fatalf("res.Body: got %q, want %q", got, want)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	res, err = c.roundTrip(newCacheRequest(t, "http://example.com/user", nil), nil, send)
+	if err != nil {
+		t.Fatalf("roundTrip(): got %v, want no error", err)
+	}
+	if got, want := readBody(t, res), "1"; got != want {
+		t.Errorf("stale res.Body: got %q, want %q", got, want)
+	}
+
+	select {
+	case <-revalidated:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("stale entry was not revalidated")
+	}
+
+	// the revalidated entry is stored once send returns
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if entry := c.get(c.key(newCacheRequest(t, "http://example.com/user", nil), nil)); entry != nil && string(entry.body) == "2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("revalidated entry was not stored")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestResourceCacheCoalescing(t *testing.T) {
+	var calls int64
+	c := NewResourceCache(0, time.Minute, 0, nil)
+
+	release := make(chan struct{})
+	send := func(req *http.Request, payload []byte) (*http.Response, error) {
+		<-release
+		return countingSend(&calls, "")(req, payload)
+	}
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 10)
+
+	for i := range bodies {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			res, err := c.roundTrip(newCacheRequest(t, "http://example.com/user", nil), nil, send)
+			if err != nil {
+				t.Errorf("%d. roundTrip(): got %v, want no error", i, err)
+				return
+			}
+
+			b, _ := ioutil.ReadAll(res.Body)
+			bodies[i] = string(b)
+		}(i)
+	}
+
+	// let every caller join the flight before it lands
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got, want := atomic.LoadInt64(&calls), int64(1); got != want {
+		t.Errorf("calls: got %d, want %d", got, want)
+	}
+
+	for i, body := range bodies {
+		if body != "1" {
+			t.Errorf("%d. res.Body: got %q, want %q", i, body, "1")
+		}
+	}
+}
+
+func TestResourceCacheCanceledCaller(t *testing.T) {
+	var calls int64
+	c := NewResourceCache(0, time.Minute, 0, nil)
+
+	release := make(chan struct{})
+	send := func(req *http.Request, payload []byte) (*http.Response, error) {
+		<-release
+
+		if err := req.Context().Err(); err != nil {
+			return nil, err
+		}
+
+		return countingSend(&calls, "")(req, payload)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+
+	go func() {
+		_, err := c.roundTrip(newCacheRequest(t, "http://example.com/user", nil).WithContext(ctx), nil, send)
+		first <- err
+	}()
+
+	// the first caller starts the flight, the second one joins it
+	time.Sleep(20 * time.Millisecond)
+
+	second := make(chan string, 1)
+
+	go func() {
+		res, err := c.roundTrip(newCacheRequest(t, "http://example.com/user", nil), nil, send)
+		if err != nil {
+			t.Errorf("roundTrip(): got %v, want no error", err)
+			second <- ""
+			return
+		}
+
+		b, _ := ioutil.ReadAll(res.Body)
+		second <- string(b)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("roundTrip(canceled): got %v, want %v", err, context.Canceled)
+	}
+
+	close(release)
+
+	if got, want := <-second, "1"; got != want {
+		t.Errorf("res.Body: got %q, want %q", got, want)
+	}
+}
+
+func TestResourceCacheKeyHeadersFromJSON(t *testing.T) {
+	tt := []struct {
+		cache string
+		want  []string
+	}{
+		{cache: `{"ttl": "1m"}`, want: []string{"Authorization", "X-Tenant"}},
+		{cache: `{"ttl": "1m", "keyHeaders": ["Authorization"]}`, want: []string{"Authorization"}},
+		{cache: `{"ttl": "1m", "keyHeaders": []}`, want: []string{}},
+	}
+
+	for i, tc := range tt {
+		r, err := parse.FromJSON([]byte(`{
+		  "body.JSONResource": {
+		    "scope": ["response"],
+		    "method": "GET",
+		    "url": "http://example.com/user",
+		    "allowedHeaders": ["Authorization"],
+		    "headers": {"X-Tenant": ":tenant"},
+		    "cache": ` + tc.cache + `
+		  }
+		}`))
+		if err != nil {
+			t.Fatalf("%d. parse.FromJSON(): got %v, want no error", i, err)
+		}
+
+		got := r.ResponseModifier().(*JSONResource).cache.keyHeaders
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%d. keyHeaders: got %v, want %v", i, got, tc.want)
+		}
+	}
+}
+
+func TestResourceCacheReset(t *testing.T) {
+	var calls int64
+	c := NewResourceCache(0, time.Minute, 0, nil)
+	send := countingSend(&calls, "")
+
+	for n := 0; n < 2; n++ {
+		if _, err := c.roundTrip(newCacheRequest(t, "http://example.com/user", nil), nil, send); err != nil {
+			t.Fatalf("roundTrip(): got %v, want no error", err)
+		}
+
+		Reset()
+	}
+
+	if got, want := atomic.LoadInt64(&calls), int64(2); got != want {
+		t.Errorf("calls: got %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,247 @@
+package body
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/martian/v3/log"
+)
+
+const (
+	defaultFailureThreshold = 5
+	defaultOpenDuration     = 30 * time.Second
+	defaultHalfOpenProbes   = 1
+
+	// shared breakers are swept of idle ones past this size, hosts resolved
+	// from templates are not known in advance
+	maxSharedCircuits = 1024
+)
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// breakers shared by the resources of the same upstream host, they outlive
+// config reloads so that a reload does not reset the state of a failing host,
+// idle ones are pruned by PruneCircuitBreakers
+var circuits = struct {
+	sync.Mutex
+	breakers map[string]*CircuitBreaker
+}{breakers: make(map[string]*CircuitBreaker)}
+
+// CircuitOpenError is returned instead of fetching a resource whose circuit is
+// open.
+type CircuitOpenError struct {
+	Circuit string
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("body.JSONResource: circuit open for %s", e.Circuit)
+}
+
+// CircuitBreaker fails fetches fast after failureThreshold consecutive failed
+// fetches for openDuration. It then lets halfOpenProbes fetches through and
+// closes again once all of them succeed.
+type CircuitBreaker struct {
+	name             string
+	failureThreshold int
+	openDuration     time.Duration
+	halfOpenProbes   int
+
+	mu         sync.Mutex
+	generation int64
+	state      circuitState
+	failures   int
+	openUntil  time.Time
+	probing    int
+	probed     int
+}
+
+// NewCircuitBreaker returns a closed CircuitBreaker, name identifies it in
+// errors.
+func NewCircuitBreaker(name string, failureThreshold int, openDuration time.Duration, halfOpenProbes int) *CircuitBreaker {
+	if failureThreshold <= 0 {
+		failureThreshold = defaultFailureThreshold
+	}
+
+	if openDuration <= 0 {
+		openDuration = defaultOpenDuration
+	}
+
+	if halfOpenProbes <= 0 {
+		halfOpenProbes = defaultHalfOpenProbes
+	}
+
+	return &CircuitBreaker{
+		name:             name,
+		failureThreshold: failureThreshold,
+		openDuration:     openDuration,
+		halfOpenProbes:   halfOpenProbes,
+		generation:       currentGeneration(),
+	}
+}
+
+// SharedCircuitBreaker returns the CircuitBreaker of the given upstream host
+// and settings, creating it on first use.
+func SharedCircuitBreaker(host string, failureThreshold int, openDuration time.Duration, halfOpenProbes int) *CircuitBreaker {
+	cb := NewCircuitBreaker(host, failureThreshold, openDuration, halfOpenProbes)
+	key := fmt.Sprintf("%s|%d|%s|%d", host, cb.failureThreshold, cb.openDuration, cb.halfOpenProbes)
+
+	circuits.Lock()
+	defer circuits.Unlock()
+
+	if shared, ok := circuits.breakers[key]; ok {
+		return shared
+	}
+
+	if len(circuits.breakers) >= maxSharedCircuits {
+		pruneCircuitBreakers()
+	}
+
+	circuits.breakers[key] = cb
+
+	return cb
+}
+
+// PruneCircuitBreakers drops the shared circuit breakers that are closed
+// without failures, they hold no state worth keeping.
+func PruneCircuitBreakers() {
+	circuits.Lock()
+	defer circuits.Unlock()
+
+	pruneCircuitBreakers()
+}
+
+// pruneCircuitBreakers drops idle shared breakers, circuits must be locked.
+func pruneCircuitBreakers() {
+	for key, cb := range circuits.breakers {
+		if cb.idle() {
+			delete(circuits.breakers, key)
+		}
+	}
+}
+
+// idle returns whether the circuit is closed without failures.
+func (cb *CircuitBreaker) idle() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.sync()
+
+	return cb.state == circuitClosed && cb.failures == 0
+}
+
+// allow returns an error when the circuit is open, probe reports whether the
+// allowed fetch is a half-open probe.
+func (cb *CircuitBreaker) allow() (probe bool, err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.sync()
+
+	switch cb.state {
+	case circuitOpen:
+		if time.Now().Before(cb.openUntil) {
+			return false, &CircuitOpenError{Circuit: cb.name}
+		}
+
+		log.Infof("body.JSONResource.CircuitBreaker: half-open %s", cb.name)
+
+		cb.state = circuitHalfOpen
+		cb.probing = 0
+		cb.probed = 0
+
+		fallthrough
+	case circuitHalfOpen:
+		if cb.probing+cb.probed >= cb.halfOpenProbes {
+			return false, &CircuitOpenError{Circuit: cb.name}
+		}
+
+		cb.probing++
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// record records the outcome of a fetch allowed by allow.
+func (cb *CircuitBreaker) record(probe bool, failed bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.generation != currentGeneration() {
+		// allowed before the last Reset
+		return
+	}
+
+	switch {
+	case probe && cb.state == circuitHalfOpen:
+		cb.probing--
+
+		if failed {
+			cb.open()
+			return
+		}
+
+		cb.probed++
+
+		if cb.probed >= cb.halfOpenProbes {
+			log.Infof("body.JSONResource.CircuitBreaker: closed %s", cb.name)
+			cb.state = circuitClosed
+			cb.failures = 0
+		}
+	case !probe && cb.state == circuitClosed:
+		if !failed {
+			cb.failures = 0
+			return
+		}
+
+		cb.failures++
+
+		if cb.failures >= cb.failureThreshold {
+			cb.open()
+		}
+	}
+}
+
+// release gives back a fetch allowed by allow without recording an outcome, a
+// released probe lets another one through.
+func (cb *CircuitBreaker) release(probe bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.generation != currentGeneration() {
+		// allowed before the last Reset
+		return
+	}
+
+	if probe && cb.state == circuitHalfOpen && cb.probing > 0 {
+		cb.probing--
+	}
+}
+
+// sync closes a circuit left over from before the last Reset, cb.mu must be
+// held.
+func (cb *CircuitBreaker) sync() {
+	if gen := currentGeneration(); cb.generation != gen {
+		cb.generation = gen
+		cb.state = circuitClosed
+		cb.failures = 0
+		cb.probing = 0
+		cb.probed = 0
+	}
+}
+
+func (cb *CircuitBreaker) open() {
+	log.Errorf("body.JSONResource.CircuitBreaker: open %s for %s", cb.name, cb.openDuration)
+
+	cb.state = circuitOpen
+	cb.openUntil = time.Now().Add(cb.openDuration)
+	cb.failures = 0
+}
@@ -0,0 +1,226 @@
+package body
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/martian/v3/proxyutil"
+)
+
+func TestCircuitBreakerStates(t *testing.T) {
+	cb := NewCircuitBreaker("example.com", 2, time.Millisecond, 1)
+
+	for i := 0; i < 2; i++ {
+		probe, err := cb.allow()
+		if err != nil {
+			t.Fatalf("%d. allow(): got %v, want no error", i, err)
+		}
+		cb.record(probe, true)
+	}
+
+	if _, err := cb.allow(); err == nil {
+		t.Fatalf("allow(): got no error, want circuit open")
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	probe, err := cb.allow()
+	if err != nil || !probe {
+		t.Fatalf("allow(): got probe %t, %v, want half-open probe", probe, err)
+	}
+	if _, err := cb.allow(); err == nil {
+		t.Errorf("allow(): got no error, want a single probe while half-open")
+	}
+
+	cb.record(probe, true)
+
+	if _, err := cb.allow(); err == nil {
+		t.Fatalf("allow(): got no error, want circuit reopened by the failed probe")
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	probe, err = cb.allow()
+	if err != nil {
+		t.Fatalf("allow(): got %v, want half-open probe", err)
+	}
+
+	cb.record(probe, false)
+
+	if !cb.idle() {
+		t.Errorf("idle(): got false, want circuit closed by the successful probe")
+	}
+}
+
+func TestCircuitBreakerSuccessResetsFailures(t *testing.T) {
+	cb := NewCircuitBreaker("example.com", 2, time.Minute, 1)
+
+	for i, failed := range []bool{true, false, true, false, true} {
+		probe, err := cb.allow()
+		if err != nil {
+			t.Fatalf("%d. allow(): got %v, want no error", i, err)
+		}
+		cb.record(probe, failed)
+	}
+
+	if _, err := cb.allow(); err != nil {
+		t.Errorf("allow(): got %v, want no error", err)
+	}
+}
+
+func TestSendCircuitBreakerFailures(t *testing.T) {
+	tt := []struct {
+		status int
+		err    error
+		open   bool
+	}{
+		{status: 200, open: false},
+		{status: 503, open: true},
+		{status: 404, open: true},
+		{err: errors.New("connection refused"), open: true},
+		{err: context.Canceled, open: false},
+	}
+
+	for i, tc := range tt {
+		m, err := NewJSONResource("GET", "http://example.com/resource", "", "", nil)
+		if err != nil {
+			t.Fatalf("%d. NewJSONResource(): got %v, want no error", i, err)
+		}
+
+		m.SetCircuitBreaker(NewCircuitBreaker(m.String(), 1, time.Minute, 1))
+		m.SetTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if tc.err != nil {
+				return nil, tc.err
+			}
+
+			return proxyutil.NewResponse(tc.status, nil, req), nil
+		}))
+
+		req, err := http.NewRequest("GET", "http://example.com/resource", nil)
+		if err != nil {
+			t.Fatalf("%d. http.NewRequest(): got %v, want no error", i, err)
+		}
+
+		m.send(req, nil)
+
+		_, err = m.send(req, nil)
+
+		var cerr *CircuitOpenError
+		if got := errors.As(err, &cerr); got != tc.open {
+			t.Errorf("%d. send() after status %d, error %v: got circuit open %t, want %t", i, tc.status, tc.err, got, tc.open)
+		}
+	}
+}
+
+func TestSendCircuitBreakerCanceledProbe(t *testing.T) {
+	m, err := NewJSONResource("GET", "http://example.com/resource", "", "", nil)
+	if err != nil {
+		t.Fatalf("NewJSONResource(): got %v, want no error", err)
+	}
+
+	cb := NewCircuitBreaker(m.String(), 1, time.Millisecond, 1)
+	m.SetCircuitBreaker(cb)
+
+	tt := []struct {
+		err error
+	}{
+		// opens the circuit
+		{err: errors.New("connection refused")},
+		// the probe is canceled by the client
+		{err: context.Canceled},
+		// the next probe is allowed and closes the circuit
+		{},
+	}
+
+	for i, tc := range tt {
+		m.SetTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if tc.err != nil {
+				return nil, tc.err
+			}
+
+			return proxyutil.NewResponse(200, nil, req), nil
+		}))
+
+		time.Sleep(5 * time.Millisecond)
+
+		req, err := http.NewRequest("GET", "http://example.com/resource", nil)
+		if err != nil {
+			t.Fatalf("%d. http.NewRequest(): got %v, want no error", i, err)
+		}
+
+		var cerr *CircuitOpenError
+		if _, err := m.send(req, nil); errors.As(err, &cerr) {
+			t.Fatalf("%d. send(): got %v, want the fetch allowed", i, err)
+		}
+	}
+
+	if !cb.idle() {
+		t.Errorf("idle(): got false, want circuit closed by the probe after the canceled one")
+	}
+}
+
+func TestHostCircuitBreakerResolvedHost(t *testing.T) {
+	Reset()
+	defer Reset()
+
+	m, err := NewJSONResource("GET", "http://:tenant.example.com/resource", "", "", nil)
+	if err != nil {
+		t.Fatalf("NewJSONResource(): got %v, want no error", err)
+	}
+
+	m.SetHostCircuitBreaker(1, time.Minute, 1)
+	m.SetTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "acme.example.com" {
+			return nil, errors.New("connection refused")
+		}
+
+		return proxyutil.NewResponse(200, nil, req), nil
+	}))
+
+	send := func(host string) error {
+		req, err := http.NewRequest("GET", "http://"+host+"/resource", nil)
+		if err != nil {
+			t.Fatalf("http.NewRequest(): got %v, want no error", err)
+		}
+
+		_, err = m.send(req, nil)
+
+		return err
+	}
+
+	send("acme.example.com")
+
+	var cerr *CircuitOpenError
+	if err := send("acme.example.com"); !errors.As(err, &cerr) {
+		t.Errorf("send(acme.example.com): got %v, want circuit open", err)
+	}
+	if err := send("globex.example.com"); err != nil {
+		t.Errorf("send(globex.example.com): got %v, want no error", err)
+	}
+}
+
+func TestPruneCircuitBreakers(t *testing.T) {
+	Reset()
+	defer Reset()
+
+	failing := SharedCircuitBreaker("failing.example.com", 5, time.Minute, 1)
+	idle := SharedCircuitBreaker("idle.example.com", 5, time.Minute, 1)
+
+	probe, err := failing.allow()
+	if err != nil {
+		t.Fatalf("allow(): got %v, want no error", err)
+	}
+	failing.record(probe, true)
+
+	PruneCircuitBreakers()
+
+	if got := SharedCircuitBreaker("failing.example.com", 5, time.Minute, 1); got != failing {
+		t.Errorf("SharedCircuitBreaker(failing.example.com): got a new breaker, want the failing one kept")
+	}
+	if got := SharedCircuitBreaker("idle.example.com", 5, time.Minute, 1); got == idle {
+		t.Errorf("SharedCircuitBreaker(idle.example.com): got the pruned breaker, want a new one")
+	}
+}
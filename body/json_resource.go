@@ -2,7 +2,9 @@ package body
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -13,27 +15,84 @@ import (
 	"github.com/google/martian/v3/log"
 	"github.com/google/martian/v3/parse"
 	"github.com/google/martian/v3/verify"
+	"github.com/imranismail/bff/bffparse"
+	"github.com/imranismail/bff/bffstatus"
 	"github.com/imranismail/bff/bffurl"
 	"github.com/imranismail/bff/config"
 	"github.com/imranismail/bff/jsonpatch"
+	"github.com/imranismail/bff/tracing"
+	"github.com/imranismail/bff/transport"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var httpClient = &http.Client{
-	Timeout: time.Second * 30,
+const defaultTimeout = 30 * time.Second
+
+// successful responses, any other status fails the fetch by default
+var defaultAcceptStatus = bffstatus.Ranges{{Min: 200, Max: 299}}
+
+var roundTripper http.RoundTripper
+
+// SetRoundTripper overrides the transport used to fetch every JSONResource, a
+// nil RoundTripper restores the configured transports.
+func SetRoundTripper(rt http.RoundTripper) {
+	roundTripper = rt
 }
 
 func init() {
 	parse.Register("body.JSONResource", jsonResourceFromJSON)
 }
 
+// StatusError is returned when a resource responds with a status code it does
+// not accept.
+type StatusError struct {
+	Resource   string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("body.JSONResource: %s responded with status %d", e.Resource, e.StatusCode)
+}
+
 type jsonResourceJSON struct {
-	Scope          []parse.ModifierType `json:"scope"`
-	ResourceURL    string               `json:"url"`
-	Method         string               `json:"method"`
-	Behavior       string               `json:"behavior"`
-	Group          string               `json:"group"`
-	AllowedHeaders []string             `json:"allowedHeaders"`
-	Modifier       json.RawMessage      `json:"modifier"`
+	Scope              []parse.ModifierType `json:"scope"`
+	ResourceURL        string               `json:"url"`
+	Method             string               `json:"method"`
+	Behavior           string               `json:"behavior"`
+	Group              string               `json:"group"`
+	AllowedHeaders     []string             `json:"allowedHeaders"`
+	Modifier           json.RawMessage      `json:"modifier"`
+	Timeout            config.Duration      `json:"timeout"`
+	Retries            int                  `json:"retries"`
+	RetryOn            RetryOn              `json:"retryOn"`
+	Backoff            config.Duration      `json:"backoff"`
+	MaxBackoff         config.Duration      `json:"maxBackoff"`
+	RetryNonIdempotent bool                 `json:"retryNonIdempotent"`
+	Required           *bool                `json:"required"`
+	Fallback           json.RawMessage      `json:"fallback"`
+	Name               string               `json:"name"`
+	DependsOn          []string             `json:"dependsOn"`
+	Body               json.RawMessage      `json:"body"`
+	Query              map[string]string    `json:"query"`
+	Headers            map[string]string    `json:"headers"`
+	Cache              *resourceCacheJSON   `json:"cache"`
+	CircuitBreaker     *circuitBreakerJSON  `json:"circuitBreaker"`
+	Transport          string               `json:"transport"`
+	AcceptStatus       bffstatus.Ranges     `json:"acceptStatus"`
+}
+
+type circuitBreakerJSON struct {
+	Scope            string          `json:"scope"`
+	FailureThreshold int             `json:"failureThreshold"`
+	OpenDuration     config.Duration `json:"openDuration"`
+	HalfOpenProbes   int             `json:"halfOpenProbes"`
+}
+
+type resourceCacheJSON struct {
+	Size                 int             `json:"size"`
+	TTL                  config.Duration `json:"ttl"`
+	StaleWhileRevalidate config.Duration `json:"staleWhileRevalidate"`
+	KeyHeaders           []string        `json:"keyHeaders"`
 }
 
 type jsonResource struct {
@@ -52,6 +111,22 @@ type JSONResource struct {
 	reqmod         martian.RequestModifier
 	resmod         martian.ResponseModifier
 	pattern        *bffurl.Pattern
+	host           *bffurl.HostPattern
+	timeout        time.Duration
+	retry          *RetryPolicy
+	required       bool
+	fallback       []byte
+	name           string
+	dependsOn      []string
+	body           []byte
+	query          map[string]string
+	headers        map[string]string
+	cache          *ResourceCache
+	breaker        *CircuitBreaker
+	hostBreaker    func(host string) *CircuitBreaker
+	transport      http.RoundTripper
+	transportName  string
+	acceptStatus   bffstatus.Ranges
 }
 
 func validBehavior(behavior string) bool {
@@ -74,7 +149,19 @@ func NewJSONResource(method string, resourceURLStr string, behavior string, grou
 
 	log.Debugf("body.JSONResource.New: method(%s) url(%s) behavior(%s)", method, resourceURLStr, behavior)
 
-	resourceURL, err := url.Parse(resourceURLStr)
+	resourceURL, err := bffurl.ParseURL(resourceURLStr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pattern, err := bffurl.ParsePattern(resourceURL.Path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	host, err := bffurl.ParseHostPattern(resourceURL.Host)
 
 	if err != nil {
 		return nil, err
@@ -86,7 +173,11 @@ func NewJSONResource(method string, resourceURLStr string, behavior string, grou
 		behavior:       behavior,
 		group:          group,
 		allowedHeaders: allowedHeaders,
-		pattern:        bffurl.NewPattern(resourceURL.Path),
+		pattern:        pattern,
+		host:           host,
+		timeout:        defaultTimeout,
+		required:       true,
+		acceptStatus:   defaultAcceptStatus,
 	}
 
 	return m, nil
@@ -102,37 +193,194 @@ func (m *JSONResource) SetResponseModifier(resmod martian.ResponseModifier) {
 	m.resmod = resmod
 }
 
-// FetchResource fetches the resource
+// SetTimeout sets the timeout of each attempt to fetch the resource, it
+// defaults to 30 seconds.
+func (m *JSONResource) SetTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	m.timeout = timeout
+}
+
+// SetRetryPolicy sets how failed fetches are retried, a nil policy disables
+// retries.
+func (m *JSONResource) SetRetryPolicy(retry *RetryPolicy) {
+	m.retry = retry
+}
+
+// SetRequired sets whether a failure to fetch the resource fails the whole
+// response, resources are required by default.
+func (m *JSONResource) SetRequired(required bool) {
+	m.required = required
+}
+
+// SetFallback sets the JSON used in place of the resource when it fails to be
+// fetched, it implies the resource is not required.
+func (m *JSONResource) SetFallback(fallback []byte) {
+	m.fallback = fallback
+
+	if fallback != nil {
+		m.required = false
+	}
+}
+
+// Required returns whether a failure to fetch the resource fails the whole
+// response.
+func (m *JSONResource) Required() bool {
+	return m.required
+}
+
+// SetName names the resource so that other resources can depend on it and
+// reference its result as {name/json/pointer}.
+func (m *JSONResource) SetName(name string) {
+	m.name = name
+}
+
+// SetDependsOn sets the names of the resources that have to be fetched before
+// this one, references to their results are resolved in the templates of the
+// upstream request.
+func (m *JSONResource) SetDependsOn(dependsOn []string) {
+	m.dependsOn = dependsOn
+}
+
+// SetBody sets the JSON template sent as the body of the upstream request.
+func (m *JSONResource) SetBody(body []byte) {
+	m.body = body
+}
+
+// SetQuery sets query params of the upstream request, values are templates.
+func (m *JSONResource) SetQuery(query map[string]string) {
+	m.query = query
+}
+
+// SetHeaders sets headers of the upstream request, values are templates.
+func (m *JSONResource) SetHeaders(headers map[string]string) {
+	m.headers = headers
+}
+
+// SetCache sets the cache GET and HEAD requests of the resource are served
+// from, a nil cache disables caching.
+func (m *JSONResource) SetCache(cache *ResourceCache) {
+	m.cache = cache
+}
+
+// SetCircuitBreaker sets the circuit breaker guarding the upstream of the
+// resource, a nil breaker disables it.
+func (m *JSONResource) SetCircuitBreaker(breaker *CircuitBreaker) {
+	m.breaker = breaker
+	m.hostBreaker = nil
+}
+
+// SetHostCircuitBreaker guards the resource with the circuit breaker shared by
+// the resources of the same upstream host, the host is resolved on every fetch.
+func (m *JSONResource) SetHostCircuitBreaker(failureThreshold int, openDuration time.Duration, halfOpenProbes int) {
+	m.breaker = nil
+	m.hostBreaker = func(host string) *CircuitBreaker {
+		return SharedCircuitBreaker(host, failureThreshold, openDuration, halfOpenProbes)
+	}
+}
+
+// SetTransport sets the transport used to fetch the resource, a nil transport
+// uses the default transport.
+func (m *JSONResource) SetTransport(rt http.RoundTripper) {
+	m.transport = rt
+}
+
+// SetTransportName sets the name of the registered transport used to fetch the
+// resource when no transport is set, it is looked up on every fetch.
+func (m *JSONResource) SetTransportName(name string) {
+	m.transportName = name
+}
+
+// SetAcceptStatus sets the upstream status codes a fetch succeeds with, any
+// other status fails it. Empty ranges accept the 2xx status codes.
+func (m *JSONResource) SetAcceptStatus(ranges bffstatus.Ranges) {
+	if len(ranges) == 0 {
+		ranges = defaultAcceptStatus
+	}
+
+	m.acceptStatus = ranges
+}
+
+// Name returns the name of the resource.
+func (m *JSONResource) Name() string {
+	return m.name
+}
+
+// DependsOn returns the names of the resources this one depends on.
+func (m *JSONResource) DependsOn() []string {
+	return m.dependsOn
+}
+
+// label identifies the resource in metrics.
+func (m *JSONResource) label() string {
+	if m.name != "" {
+		return m.name
+	}
+
+	return m.String()
+}
+
+// String identifies the resource in errors.
+func (m *JSONResource) String() string {
+	return fmt.Sprintf("%s %s", m.method, m.resourceURL)
+}
+
+// FetchResource fetches the resource. When the resource has a fallback, the
+// fallback is returned along with the fetch error.
 func (m *JSONResource) FetchResource(downstreamReq *http.Request) (martian.ResponseModifier, error) {
-	log.Debugf("body.JSONResource.FetchResource: method(%s) url(%s) allowedHeaders(%s)", m.method, m.resourceURL, m.allowedHeaders)
+	c, span := tracing.Start(tracing.Context(martian.NewContext(downstreamReq)), "fetch "+m.label(), trace.SpanKindClient)
+	defer span.End()
 
-	upstreamReq, err := http.NewRequest(
-		m.method,
-		m.resourceURL.String(),
-		bytes.NewBuffer([]byte{}),
-	)
+	start := time.Now()
+	resource, err := m.fetch(c, downstreamReq)
+	fetchDuration.WithLabelValues(m.label()).Observe(time.Since(start).Seconds())
+	tracing.SetError(span, err)
 
 	if err != nil {
-		return nil, err
+		fetchErrors.WithLabelValues(m.label()).Inc()
 	}
 
-	upstreamReq.Header.Set("User-Agent", fmt.Sprintf("bff/%s", config.Version))
-	upstreamReq.Header.Set("Accept", "application/json")
+	if err != nil && m.fallback != nil {
+		setResult(martian.NewContext(downstreamReq), m.name, m.fallback)
+		return m.newResource(m.fallback), err
+	}
 
-	for _, allowed := range m.allowedHeaders {
-		header := downstreamReq.Header.Get(allowed)
+	if err != nil {
+		return nil, err
+	}
 
-		if header != "" {
-			upstreamReq.Header.Add(allowed, header)
-		}
+	return resource, nil
+}
+
+func (m *JSONResource) newResource(body []byte) *jsonResource {
+	return &jsonResource{
+		body:     body,
+		behavior: m.behavior,
+		group:    m.group,
 	}
+}
+
+func (m *JSONResource) fetch(c context.Context, downstreamReq *http.Request) (*jsonResource, error) {
+	log.Debugf("body.JSONResource.FetchResource: method(%s) url(%s) allowedHeaders(%s)", m.method, m.resourceURL, m.allowedHeaders)
 
-	if upstreamReq.URL.Path != "" {
-		ctx := martian.NewContext(downstreamReq)
-		upstreamReq.URL.Path = m.pattern.ReplaceParams(ctx, upstreamReq.URL.Path)
+	upstreamReq, err := m.newUpstreamRequest(downstreamReq)
+
+	if err != nil {
+		return nil, err
 	}
 
-	_, cleanup, err := martian.TestContext(upstreamReq, nil, nil)
+	span := trace.SpanFromContext(c)
+	span.SetAttributes(
+		attribute.String("http.method", upstreamReq.Method),
+		attribute.String("http.url", upstreamReq.URL.String()),
+	)
+	tracing.Inject(c, upstreamReq.Header)
+
+	ctx := martian.NewContext(downstreamReq)
+
+	upstreamCtx, cleanup, err := martian.TestContext(upstreamReq, nil, nil)
 
 	if err != nil {
 		return nil, err
@@ -140,6 +388,9 @@ func (m *JSONResource) FetchResource(downstreamReq *http.Request) (martian.Respo
 
 	defer cleanup()
 
+	// the spans of the nested modifier are children of the fetch
+	tracing.SetContext(upstreamCtx, c)
+
 	if m.reqmod != nil {
 		err = m.reqmod.ModifyRequest(upstreamReq)
 
@@ -148,39 +399,306 @@ func (m *JSONResource) FetchResource(downstreamReq *http.Request) (martian.Respo
 		}
 	}
 
-	res, err := httpClient.Do(upstreamReq)
+	res, err := m.roundTrip(upstreamReq)
 
 	if err != nil {
 		return nil, err
 	}
 
+	span.SetAttributes(attribute.Int("http.status_code", res.StatusCode))
+	bffstatus.SetStatusCode(downstreamReq, res.StatusCode)
+
 	defer res.Body.Close()
 
+	if m.failed(res, nil) {
+		return nil, &StatusError{Resource: m.String(), StatusCode: res.StatusCode}
+	}
+
 	res.Request = upstreamReq
 
+	if m.resmod != nil {
+		err = m.resmod.ModifyResponse(res)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// optional resources verify right away so a failed verification is
+	// handled like a failed fetch instead of failing the whole response
+	if resv, ok := m.resmod.(verify.ResponseVerifier); ok && !m.required {
+		err := resv.VerifyResponses()
+		resv.ResetResponseVerifications()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+
 	if err != nil {
 		return nil, err
 	}
 
-	if m.resmod != nil {
-		err = m.resmod.ModifyResponse(res)
+	setResult(ctx, m.name, body)
+
+	return m.newResource(body), nil
+}
+
+// referencesBody returns whether the templates of the resource reference the
+// body of the downstream request.
+func (m *JSONResource) referencesBody() bool {
+	templates := []string{m.resourceURL.Path, m.resourceURL.RawQuery, string(m.body)}
+
+	for _, template := range m.query {
+		templates = append(templates, template)
+	}
+
+	for _, template := range m.headers {
+		templates = append(templates, template)
+	}
+
+	for _, template := range templates {
+		if referencesSource(template, bodySource) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newUpstreamRequest builds the request for the resource, resolving the
+// templates of the URL, query, headers and body against the downstream request
+// and the results of the resources this one depends on.
+func (m *JSONResource) newUpstreamRequest(downstreamReq *http.Request) (*http.Request, error) {
+	ctx := martian.NewContext(downstreamReq)
+	noescape := func(s string) string { return s }
+	u := *m.resourceURL
+	u.Host = m.host.ReplaceParams(ctx, u.Host)
+
+	if u.Path != "" {
+		escaped := escapeTemplate(m.pattern.ReplaceParams(ctx, u.Path), func(s string) string {
+			return (&url.URL{Path: s}).EscapedPath()
+		})
+
+		rawPath, err := resolveString(downstreamReq, escaped, url.PathEscape)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if u.Path, err = url.PathUnescape(rawPath); err != nil {
+			return nil, err
+		}
+
+		u.RawPath = rawPath
+	}
+
+	rawQuery, err := resolveString(downstreamReq, u.RawQuery, url.QueryEscape)
+
+	if err != nil {
+		return nil, err
+	}
+
+	u.RawQuery = rawQuery
+
+	if len(m.query) > 0 {
+		query := u.Query()
+
+		for key, template := range m.query {
+			value, err := resolveString(downstreamReq, template, noescape)
+
+			if err != nil {
+				return nil, err
+			}
+
+			query.Set(key, value)
+		}
+
+		u.RawQuery = query.Encode()
+	}
+
+	body := []byte{}
+
+	if m.body != nil {
+		if body, err = resolveJSON(downstreamReq, m.body); err != nil {
+			return nil, err
+		}
+	}
+
+	// fetches are abandoned along with the downstream request
+	upstreamReq, err := http.NewRequestWithContext(downstreamReq.Context(), m.method, u.String(), bytes.NewBuffer(body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	upstreamReq.Header.Set("User-Agent", fmt.Sprintf("bff/%s", config.Version))
+	upstreamReq.Header.Set("Accept", "application/json")
+
+	if m.body != nil {
+		upstreamReq.Header.Set("Content-Type", "application/json")
+	}
+
+	for _, allowed := range m.allowedHeaders {
+		header := downstreamReq.Header.Get(allowed)
+
+		if header != "" {
+			upstreamReq.Header.Add(allowed, header)
+		}
+	}
+
+	for key, template := range m.headers {
+		value, err := resolveString(downstreamReq, template, noescape)
 
 		if err != nil {
 			return nil, err
 		}
+
+		upstreamReq.Header.Set(key, value)
+	}
+
+	return upstreamReq, nil
+}
+
+// roundTrip sends req through the cache when there is one, and returns the
+// response with its body fully read.
+func (m *JSONResource) roundTrip(req *http.Request) (*http.Response, error) {
+	payload, err := ioutil.ReadAll(req.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Body.Close()
+
+	if m.cache != nil && (req.Method == http.MethodGet || req.Method == http.MethodHead) {
+		return m.cache.roundTrip(req, payload, m.send)
+	}
+
+	return m.send(req, payload)
+}
+
+// send sends req through the circuit breaker when there is one.
+func (m *JSONResource) send(req *http.Request, payload []byte) (*http.Response, error) {
+	breaker := m.breaker
+
+	if m.hostBreaker != nil {
+		breaker = m.hostBreaker(req.URL.Host)
+	}
+
+	if breaker == nil {
+		return m.sendWithRetries(req, payload)
+	}
+
+	probe, err := breaker.allow()
+
+	if err != nil {
+		return nil, err
 	}
 
+	res, err := m.sendWithRetries(req, payload)
+
+	// a canceled downstream request says nothing about the upstream
+	if errors.Is(err, context.Canceled) {
+		breaker.release(probe)
+	} else {
+		breaker.record(probe, m.failed(res, err))
+	}
+
+	return res, err
+}
+
+// failed returns whether a fetch failed, a fetch fails on errors and on
+// statuses the resource does not accept.
+func (m *JSONResource) failed(res *http.Response, err error) bool {
+	return err != nil || !m.acceptStatus.Contains(res.StatusCode)
+}
+
+// sendWithRetries sends req, retrying according to m.retry, and returns the
+// last response. It stops waiting between attempts once req is canceled.
+func (m *JSONResource) sendWithRetries(req *http.Request, payload []byte) (*http.Response, error) {
+	attempts := m.retry.attempts(req.Method)
+
+	var res *http.Response
+	var err error
+
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			backoff := m.retry.backoff(attempt)
+			log.Debugf("body.JSONResource.FetchResource: retry(%d) url(%s) backoff(%s)", attempt, req.URL, backoff)
+
+			timer := time.NewTimer(backoff)
+
+			select {
+			case <-timer.C:
+			case <-req.Context().Done():
+				timer.Stop()
+				return nil, req.Context().Err()
+			}
+		}
+
+		res, err = m.try(req, payload)
+
+		if attempt == attempts-1 || !m.retry.retryable(res, err) {
+			break
+		}
+	}
+
+	return res, err
+}
+
+// try sends a single attempt of req bounded by m.timeout.
+func (m *JSONResource) try(req *http.Request, payload []byte) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), m.timeout)
+	defer cancel()
+
+	attempt := req.Clone(ctx)
+	attempt.ContentLength = int64(len(payload))
+	attempt.Body = http.NoBody
+
+	if len(payload) > 0 {
+		attempt.Body = ioutil.NopCloser(bytes.NewReader(payload))
+	}
+
+	rt, err := m.roundTripper()
+
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := (&http.Client{Transport: rt}).Do(attempt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
 	body, err := ioutil.ReadAll(res.Body)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &jsonResource{
-		body:     body,
-		behavior: m.behavior,
-		group:    m.group,
-	}, nil
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	return res, nil
+}
+
+// roundTripper returns the transport of the resource, the named or default
+// transport is looked up on every fetch so that it follows config reloads.
+func (m *JSONResource) roundTripper() (http.RoundTripper, error) {
+	if roundTripper != nil {
+		return roundTripper, nil
+	}
+
+	if m.transport != nil {
+		return m.transport, nil
+	}
+
+	return transport.Get(m.transportName)
 }
 
 // ModifyResponse patches the response body.
@@ -189,10 +707,18 @@ func (m *JSONResource) ModifyResponse(res *http.Response) error {
 
 	resource, err := m.FetchResource(res.Request)
 
-	if err != nil {
+	if err != nil && m.required {
 		return err
 	}
 
+	if err != nil {
+		log.Errorf("body.JSONResource.ModifyResponse: optional resource %s failed: %v", m, err)
+	}
+
+	if resource == nil {
+		return nil
+	}
+
 	return resource.ModifyResponse(res)
 }
 
@@ -208,6 +734,10 @@ func (m *JSONResource) ResetResponseVerifications() {
 func (m *JSONResource) VerifyResponses() error {
 	log.Debugf("body.JSONResource.VerifyResponse")
 
+	if !m.required {
+		return nil
+	}
+
 	if resv, ok := m.resmod.(verify.ResponseVerifier); ok {
 		if err := resv.VerifyResponses(); err != nil {
 			return err
@@ -230,8 +760,77 @@ func jsonResourceFromJSON(b []byte) (*parse.Result, error) {
 		return nil, err
 	}
 
+	m.SetTimeout(time.Duration(msg.Timeout))
+	m.SetAcceptStatus(msg.AcceptStatus)
+
+	if msg.Required != nil {
+		m.SetRequired(*msg.Required)
+	}
+
+	if msg.Fallback != nil {
+		m.SetFallback(msg.Fallback)
+	}
+
+	if reservedName(msg.Name) {
+		return nil, fmt.Errorf("body.JSONResource: %q is a reserved name", msg.Name)
+	}
+
+	m.SetName(msg.Name)
+	m.SetDependsOn(msg.DependsOn)
+	m.SetBody(msg.Body)
+	m.SetQuery(msg.Query)
+	m.SetHeaders(msg.Headers)
+
+	if m.referencesBody() {
+		trackBodyReference()
+	}
+
+	if c := msg.Cache; c != nil {
+		keyHeaders := c.KeyHeaders
+
+		// the headers resolved from the downstream request
+		if keyHeaders == nil {
+			keyHeaders = append(keyHeaders, msg.AllowedHeaders...)
+
+			for header := range msg.Headers {
+				keyHeaders = append(keyHeaders, header)
+			}
+		}
+
+		m.SetCache(NewResourceCache(c.Size, time.Duration(c.TTL), time.Duration(c.StaleWhileRevalidate), keyHeaders))
+	}
+
+	if cb := msg.CircuitBreaker; cb != nil {
+		switch cb.Scope {
+		case "", "host":
+			m.SetHostCircuitBreaker(cb.FailureThreshold, time.Duration(cb.OpenDuration), cb.HalfOpenProbes)
+		case "resource":
+			m.SetCircuitBreaker(NewCircuitBreaker(m.String(), cb.FailureThreshold, time.Duration(cb.OpenDuration), cb.HalfOpenProbes))
+		default:
+			return nil, fmt.Errorf("body.JSONResource: invalid circuitBreaker scope %q", cb.Scope)
+		}
+	}
+
+	if msg.Transport != "" {
+		if err := transport.Check(msg.Transport); err != nil {
+			return nil, err
+		}
+
+		m.SetTransportName(msg.Transport)
+	}
+
+	if msg.Retries > 0 {
+		m.SetRetryPolicy(NewRetryPolicy(
+			msg.Retries,
+			msg.RetryOn,
+			time.Duration(msg.Backoff),
+			time.Duration(msg.MaxBackoff),
+			msg.RetryNonIdempotent,
+		))
+	}
+
 	if msg.Modifier != nil {
-		r, err := parse.FromJSON(msg.Modifier)
+		r, err := bffparse.FromJSON(msg.Modifier)
 
 		if err != nil {
 			return nil, err
@@ -0,0 +1,115 @@
+package body
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/google/martian/v3"
+	"github.com/google/martian/v3/proxyutil"
+	"github.com/imranismail/bff/bffstatus"
+)
+
+// respond answers every upstream request with status and body.
+func respond(status int, body string) roundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		res := proxyutil.NewResponse(status, bytes.NewReader([]byte(body)), req)
+		res.Header.Set("Content-Type", "application/json")
+
+		return res, nil
+	}
+}
+
+func newDownstreamRequest(t *testing.T) *http.Request {
+	t.Helper()
+
+	req, err := http.NewRequest("GET", "http://example.com/", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest(): got %v, want no error", err)
+	}
+
+	_, remove, err := martian.TestContext(req, nil, nil)
+	if err != nil {
+		t.Fatalf("martian.TestContext(): got %v, want no error", err)
+	}
+	t.Cleanup(remove)
+
+	return req
+}
+
+func TestFetchResourceStatus(t *testing.T) {
+	tt := []struct {
+		status  int
+		accept  bffstatus.Ranges
+		wantErr bool
+	}{
+		{status: 200},
+		{status: 204},
+		{status: 404, wantErr: true},
+		{status: 500, wantErr: true},
+		{status: 302, wantErr: true},
+		{status: 404, accept: bffstatus.Ranges{{Min: 200, Max: 299}, {Min: 404, Max: 404}}},
+		{status: 200, accept: bffstatus.Ranges{{Min: 404, Max: 404}}, wantErr: true},
+	}
+
+	for i, tc := range tt {
+		m, err := NewJSONResource("GET", "http://example.com/resource", "", "", nil)
+		if err != nil {
+			t.Fatalf("%d. NewJSONResource(): got %v, want no error", i, err)
+		}
+
+		m.SetTransport(respond(tc.status, `{}`))
+		m.SetAcceptStatus(tc.accept)
+
+		req := newDownstreamRequest(t)
+		_, err = m.FetchResource(req)
+
+		// recorded for the request phase of status.Filter
+		if got, ok := bffstatus.StatusCode(req); !ok || got != tc.status {
+			t.Errorf("%d. bffstatus.StatusCode(): got %d, %t, want %d", i, got, ok, tc.status)
+		}
+
+		var serr *StatusError
+		if got := errors.As(err, &serr); got != tc.wantErr {
+			t.Fatalf("%d. FetchResource(): got error %v, want status error %t", i, err, tc.wantErr)
+		}
+		if tc.wantErr && serr.StatusCode != tc.status {
+			t.Errorf("%d. StatusError.StatusCode: got %d, want %d", i, serr.StatusCode, tc.status)
+		}
+	}
+}
+
+func TestFetchResourceStatusFallback(t *testing.T) {
+	m, err := NewJSONResource("GET", "http://example.com/resource", "", "", nil)
+	if err != nil {
+		t.Fatalf("NewJSONResource(): got %v, want no error", err)
+	}
+
+	m.SetTransport(respond(503, `{"error":"unavailable"}`))
+	m.SetFallback([]byte(`{"fallback":true}`))
+
+	req := newDownstreamRequest(t)
+
+	resource, err := m.FetchResource(req)
+	if err == nil {
+		t.Fatalf("FetchResource(): got no error, want status error")
+	}
+	if resource == nil {
+		t.Fatalf("FetchResource(): got no resource, want fallback")
+	}
+
+	res := proxyutil.NewResponse(200, bytes.NewReader([]byte(`{}`)), req)
+	if err := resource.ModifyResponse(res); err != nil {
+		t.Fatalf("ModifyResponse(): got %v, want no error", err)
+	}
+
+	got, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("ioutil.ReadAll(): got %v, want no error", err)
+	}
+	if want := `{"fallback":true}`; string(got) != want {
+		t.Errorf("res.Body: got %s, want %s", got, want)
+	}
+}
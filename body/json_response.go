@@ -0,0 +1,127 @@
+package body
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/google/martian/v3"
+	"github.com/google/martian/v3/log"
+	"github.com/google/martian/v3/parse"
+)
+
+func init() {
+	parse.Register("body.JSONResponse", jsonResponseFromJSON)
+}
+
+type jsonResponseJSON struct {
+	Scope      []parse.ModifierType `json:"scope"`
+	StatusCode int                  `json:"statusCode"`
+	Headers    map[string]string    `json:"headers"`
+	Body       json.RawMessage      `json:"body"`
+}
+
+// JSONResponse sets the status, headers and JSON body of responses. On
+// requests it skips the round trip, so the response is answered by bff alone.
+type JSONResponse struct {
+	statusCode int
+	headers    map[string]string
+	body       []byte
+	pattern    *Pattern
+}
+
+// NewJSONResponse constructs and returns a body.JSONResponse, a zero status
+// code or a nil body keeps the ones of the response.
+func NewJSONResponse(statusCode int, headers map[string]string, body []byte) *JSONResponse {
+	log.Debugf("body.JSONResponse.New: status(%d)", statusCode)
+
+	m := &JSONResponse{
+		statusCode: statusCode,
+		headers:    headers,
+		body:       body,
+	}
+
+	if body != nil {
+		m.pattern = NewPattern(body)
+	}
+
+	return m
+}
+
+// ModifyRequest skips the round trip of the request.
+func (m *JSONResponse) ModifyRequest(req *http.Request) error {
+	log.Debugf("body.JSONResponse.ModifyRequest: request: %s", req.URL)
+
+	if ctx := martian.NewContext(req); ctx != nil {
+		ctx.SkipRoundTrip()
+	}
+
+	return nil
+}
+
+// ModifyResponse sets the status, headers and body of the response, params
+// captured by bff.URLFilter are substituted in the body.
+func (m *JSONResponse) ModifyResponse(res *http.Response) error {
+	log.Debugf("body.JSONResponse.ModifyResponse: request: %s", res.Request.URL)
+
+	if m.statusCode != 0 {
+		res.StatusCode = m.statusCode
+		res.Status = fmt.Sprintf("%d %s", m.statusCode, http.StatusText(m.statusCode))
+	}
+
+	if m.body != nil {
+		body := m.pattern.ReplaceParams(m.body, res.Request)
+
+		if res.Body != nil {
+			res.Body.Close()
+		}
+
+		res.ContentLength = int64(len(body))
+		res.Body = ioutil.NopCloser(bytes.NewReader(body))
+		res.Header.Set("Content-Type", "application/json")
+		res.Header.Set("Content-Length", fmt.Sprint(len(body)))
+		res.Header.Del("Content-Encoding")
+		res.TransferEncoding = nil
+	}
+
+	for name, value := range m.headers {
+		res.Header.Set(name, value)
+	}
+
+	return nil
+}
+
+// jsonResponseFromJSON builds a body.JSONResponse from JSON.
+//
+// Example modifier JSON:
+// {
+//   "body.JSONResponse": {
+//     "scope": ["request", "response"],
+//     "statusCode": 200,
+//     "headers": { "Cache-Control": "no-store" },
+//     "body": { "id": ":id", "items": [] }
+//   }
+// }
+func jsonResponseFromJSON(b []byte) (*parse.Result, error) {
+	msg := &jsonResponseJSON{}
+
+	if err := json.Unmarshal(b, msg); err != nil {
+		return nil, err
+	}
+
+	if msg.StatusCode != 0 && (msg.StatusCode < 100 || msg.StatusCode > 599) {
+		return nil, fmt.Errorf("body.JSONResponse: invalid status code %d", msg.StatusCode)
+	}
+
+	var body []byte
+
+	if len(msg.Body) > 0 {
+		body = []byte(msg.Body)
+	}
+
+	mod := NewJSONResponse(msg.StatusCode, msg.Headers, body)
+
+	return parse.NewResult(mod, msg.Scope)
+}
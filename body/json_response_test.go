@@ -0,0 +1,110 @@
+package body
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/google/martian/v3"
+	"github.com/google/martian/v3/parse"
+	"github.com/google/martian/v3/proxyutil"
+)
+
+func TestJSONResponseFromJSON(t *testing.T) {
+	msg := []byte(`{
+	  "body.JSONResponse": {
+	    "scope": ["request", "response"],
+	    "statusCode": 201,
+	    "headers": {"Cache-Control": "no-store"},
+	    "body": {"id": ":id", "theme": ":theme", "items": []}
+	  }
+	}`)
+
+	r, err := parse.FromJSON(msg)
+	if err != nil {
+		t.Fatalf("parse.FromJSON(): got %v, want no error", err)
+	}
+
+	req, err := http.NewRequest("GET", "http://example.com/users/42", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest(): got %v, want no error", err)
+	}
+
+	ctx, remove, err := martian.TestContext(req, nil, nil)
+	if err != nil {
+		t.Fatalf("martian.TestContext(): got %v, want no error", err)
+	}
+	defer remove()
+
+	ctx.Set("bffurl.ParamName.id", "42")
+
+	if err := r.RequestModifier().ModifyRequest(req); err != nil {
+		t.Fatalf("ModifyRequest(): got %v, want no error", err)
+	}
+	if !ctx.SkippingRoundTrip() {
+		t.Error("ctx.SkippingRoundTrip(): got false, want true")
+	}
+
+	res := proxyutil.NewResponse(200, bytes.NewReader([]byte(`{"upstream":true}`)), req)
+	res.Header.Set("Content-Encoding", "gzip")
+
+	if err := r.ResponseModifier().ModifyResponse(res); err != nil {
+		t.Fatalf("ModifyResponse(): got %v, want no error", err)
+	}
+
+	if got, want := res.StatusCode, 201; got != want {
+		t.Errorf("res.StatusCode: got %d, want %d", got, want)
+	}
+	if got, want := res.Status, "201 Created"; got != want {
+		t.Errorf("res.Status: got %q, want %q", got, want)
+	}
+
+	for name, want := range map[string]string{
+		"Cache-Control":    "no-store",
+		"Content-Type":     "application/json",
+		"Content-Encoding": "",
+	} {
+		if got := res.Header.Get(name); got != want {
+			t.Errorf("res.Header.Get(%q): got %q, want %q", name, got, want)
+		}
+	}
+
+	// params that were not captured are left as is
+	if got, want := readBody(t, res), `{"id": "42", "theme": ":theme", "items": []}`; got != want {
+		t.Errorf("res.Body: got %s, want %s", got, want)
+	}
+}
+
+func TestJSONResponseKeepsResponse(t *testing.T) {
+	m := NewJSONResponse(0, nil, nil)
+
+	req, err := http.NewRequest("GET", "http://example.com/", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest(): got %v, want no error", err)
+	}
+
+	res := proxyutil.NewResponse(404, bytes.NewReader([]byte(`{"upstream":true}`)), req)
+
+	if err := m.ModifyResponse(res); err != nil {
+		t.Fatalf("ModifyResponse(): got %v, want no error", err)
+	}
+
+	if got, want := res.StatusCode, 404; got != want {
+		t.Errorf("res.StatusCode: got %d, want %d", got, want)
+	}
+	if got, want := readBody(t, res), `{"upstream":true}`; got != want {
+		t.Errorf("res.Body: got %s, want %s", got, want)
+	}
+}
+
+func TestJSONResponseFromJSONErrors(t *testing.T) {
+	for i, msg := range []string{
+		`{"body.JSONResponse": {"statusCode": 99}}`,
+		`{"body.JSONResponse": {"statusCode": 600}}`,
+		`{"body.JSONResponse": {"headers": []}}`,
+	} {
+		if _, err := parse.FromJSON([]byte(msg)); err == nil {
+			t.Errorf("%d. parse.FromJSON(%s): got no error, want error", i, msg)
+		}
+	}
+}
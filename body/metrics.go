@@ -0,0 +1,21 @@
+package body
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	fetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "bff_resource_fetch_duration_seconds",
+		Help: "Duration of the upstream fetches of a JSONResource, including retries.",
+	}, []string{"resource"})
+	fetchErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bff_resource_fetch_errors_total",
+		Help: "Number of failed upstream fetches of a JSONResource.",
+	}, []string{"resource"})
+	fanOutDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "bff_multifetcher_duration_seconds",
+		Help: "Duration of the fetches of all the resources of a MultiFetcher.",
+	}, []string{"route"})
+)
@@ -0,0 +1,51 @@
+package body
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/martian/v3"
+	"github.com/google/martian/v3/proxyutil"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFetchErrorsMetric(t *testing.T) {
+	ok := newNamedResource(t, "metrics-ok", "http://example.com/ok", nil, func(req *http.Request) (*http.Response, error) {
+		return proxyutil.NewResponse(200, nil, req), nil
+	})
+	failed := newNamedResource(t, "metrics-failed", "http://example.com/failed", nil, func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	})
+
+	for n := 0; n < 2; n++ {
+		for _, m := range []*JSONResource{ok, failed} {
+			req, err := http.NewRequest("GET", "http://example.com", nil)
+			if err != nil {
+				t.Fatalf("http.NewRequest(): got %v, want no error", err)
+			}
+
+			_, remove, err := martian.TestContext(req, nil, nil)
+			if err != nil {
+				t.Fatalf("martian.TestContext(): got %v, want no error", err)
+			}
+
+			m.FetchResource(req)
+			remove()
+		}
+	}
+
+	tt := []struct {
+		resource string
+		want     float64
+	}{
+		{resource: "metrics-ok", want: 0},
+		{resource: "metrics-failed", want: 2},
+	}
+
+	for i, tc := range tt {
+		if got := testutil.ToFloat64(fetchErrors.WithLabelValues(tc.resource)); got != tc.want {
+			t.Errorf("%d. bff_resource_fetch_errors_total{resource=%q}: got %v, want %v", i, tc.resource, got, tc.want)
+		}
+	}
+}
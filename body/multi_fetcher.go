@@ -1,23 +1,34 @@
 package body
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/martian/v3"
 	"github.com/google/martian/v3/log"
 	"github.com/google/martian/v3/parse"
 	"github.com/google/martian/v3/verify"
+	"github.com/imranismail/bff/bffurl"
+	"github.com/imranismail/bff/jsonpatch"
 )
 
+const defaultErrorsPath = "/_errors"
+
 func init() {
 	parse.Register("body.MultiFetcher", multiFetcherFromJSON)
 }
 
 type multiFetcherJSON struct {
-	Scope     []parse.ModifierType `json:"scope"`
-	Resources []json.RawMessage    `json:"resources"`
+	Scope      []parse.ModifierType `json:"scope"`
+	Resources  []json.RawMessage    `json:"resources"`
+	ErrorsPath string               `json:"errorsPath"`
 }
 
 // ResourceFetcher WIP
@@ -26,66 +37,317 @@ type ResourceFetcher interface {
 	FetchResource(*http.Request) (martian.ResponseModifier, error)
 }
 
+// OptionalFetcher is a ResourceFetcher that may not be required, the failures
+// of optional fetchers are recorded in the response instead of failing it.
+type OptionalFetcher interface {
+	ResourceFetcher
+	Required() bool
+}
+
+// DependentFetcher is a ResourceFetcher that is named and may depend on other
+// named fetchers of the same MultiFetcher.
+type DependentFetcher interface {
+	ResourceFetcher
+	Name() string
+	DependsOn() []string
+}
+
 // MultiFetcher let you change the name of the fields of the generated responses
 type MultiFetcher struct {
-	fetchers []ResourceFetcher
+	fetchers   []ResourceFetcher
+	levels     [][]int
+	deps       [][]int
+	errorsPath string
+}
+
+// DependencyError is the error of a resource that is not fetched since a
+// resource it depends on failed without a fallback.
+type DependencyError struct {
+	Resource   string
+	Dependency string
 }
 
-// NewMultiFetcher constructs and returns a body.JSONDataSourceModifier.
-func NewMultiFetcher(fetchers []ResourceFetcher) *MultiFetcher {
-	return &MultiFetcher{fetchers: fetchers}
+func (e *DependencyError) Error() string {
+	return fmt.Sprintf("body.MultiFetcher: %s not fetched, its dependency %s failed", e.Resource, e.Dependency)
+}
+
+type resourceError struct {
+	Resource string `json:"resource"`
+	Code     string `json:"code,omitempty"`
+	Message  string `json:"message"`
+}
+
+// NewMultiFetcher constructs and returns a body.MultiFetcher. Fetchers are
+// fetched in levels, each level concurrently and after the levels holding the
+// fetchers it depends on. Unknown dependencies and cycles are rejected.
+func NewMultiFetcher(fetchers []ResourceFetcher) (*MultiFetcher, error) {
+	levels, deps, err := sortFetchers(fetchers)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &MultiFetcher{fetchers: fetchers, levels: levels, deps: deps, errorsPath: defaultErrorsPath}, nil
+}
+
+// sortFetchers groups the indices of fetchers into levels so that every
+// fetcher comes after the ones it depends on, it also returns the indices of
+// the dependencies of every fetcher.
+func sortFetchers(fetchers []ResourceFetcher) ([][]int, [][]int, error) {
+	names := make(map[string]int)
+
+	for i, fetcher := range fetchers {
+		if df, ok := fetcher.(DependentFetcher); ok && df.Name() != "" {
+			if _, dup := names[df.Name()]; dup {
+				return nil, nil, fmt.Errorf("body.MultiFetcher: duplicate resource name %q", df.Name())
+			}
+
+			names[df.Name()] = i
+		}
+	}
+
+	pending := make([]int, len(fetchers))
+	deps := make([][]int, len(fetchers))
+	dependents := make([][]int, len(fetchers))
+
+	for i, fetcher := range fetchers {
+		df, ok := fetcher.(DependentFetcher)
+
+		if !ok {
+			continue
+		}
+
+		for _, dep := range df.DependsOn() {
+			j, ok := names[dep]
+
+			if !ok {
+				return nil, nil, fmt.Errorf("body.MultiFetcher: %s depends on unknown resource %q", describe(i, fetcher), dep)
+			}
+
+			pending[i]++
+			deps[i] = append(deps[i], j)
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	var levels [][]int
+	var level []int
+	sorted := 0
+
+	for i := range fetchers {
+		if pending[i] == 0 {
+			level = append(level, i)
+		}
+	}
+
+	for len(level) > 0 {
+		levels = append(levels, level)
+		sorted += len(level)
+
+		var next []int
+
+		for _, i := range level {
+			for _, j := range dependents[i] {
+				pending[j]--
+
+				if pending[j] == 0 {
+					next = append(next, j)
+				}
+			}
+		}
+
+		sort.Ints(next)
+		level = next
+	}
+
+	if sorted < len(fetchers) {
+		var cyclic []string
+
+		for i, fetcher := range fetchers {
+			if pending[i] > 0 {
+				cyclic = append(cyclic, describe(i, fetcher))
+			}
+		}
+
+		return nil, nil, fmt.Errorf("body.MultiFetcher: dependency cycle between %s", strings.Join(cyclic, ", "))
+	}
+
+	return levels, deps, nil
+}
+
+// SetErrorsPath sets the JSON pointer in the response body where the failures
+// of optional resources are recorded, it defaults to /_errors.
+func (m *MultiFetcher) SetErrorsPath(path string) {
+	if path == "" {
+		path = defaultErrorsPath
+	}
+
+	m.errorsPath = path
 }
 
 // ModifyResponse patches the response body.
 func (m *MultiFetcher) ModifyResponse(res *http.Response) error {
 	log.Debugf("body.MultiFetcher.ModifyResponse: request: %s", res.Request.URL)
 
-	resources := make(map[int]martian.ResponseModifier)
-	resmu := sync.Mutex{}
-	merrmu := sync.Mutex{}
-	merr := martian.NewMultiError()
-	wg := sync.WaitGroup{}
+	resources := make([]martian.ResponseModifier, len(m.fetchers))
+	errs := make([]error, len(m.fetchers))
+	failures := make([]resourceError, 0)
+	start := time.Now()
 
-	for i, fetcher := range m.fetchers {
-		wg.Add(1)
+	defer func() {
+		fanOutDuration.WithLabelValues(bffurl.Route(martian.NewContext(res.Request))).Observe(time.Since(start).Seconds())
+	}()
 
-		go func(i int, fetcher ResourceFetcher) {
-			defer wg.Done()
-			resource, err := fetcher.FetchResource(res.Request)
+	for _, level := range m.levels {
+		wg := sync.WaitGroup{}
 
-			if err != nil {
-				merrmu.Lock()
-				merr.Add(err)
-				merrmu.Unlock()
+		for _, i := range level {
+			if err := m.failedDependency(i, resources, errs); err != nil {
+				errs[i] = err
+				continue
 			}
 
-			resmu.Lock()
-			resources[i] = resource
-			resmu.Unlock()
-		}(i, fetcher)
-	}
+			wg.Add(1)
+
+			go func(i int, fetcher ResourceFetcher) {
+				defer wg.Done()
+				resources[i], errs[i] = fetcher.FetchResource(res.Request)
+			}(i, m.fetchers[i])
+		}
 
-	wg.Wait()
+		wg.Wait()
 
-	merrmu.Lock()
-	if !merr.Empty() {
-		return merr
+		merr := martian.NewMultiError()
+
+		for _, i := range level {
+			err := errs[i]
+
+			if err == nil {
+				continue
+			}
+
+			if optional, ok := m.fetchers[i].(OptionalFetcher); ok && !optional.Required() {
+				log.Errorf("body.MultiFetcher.ModifyResponse: optional resource %s failed: %v", describe(i, m.fetchers[i]), err)
+				failures = append(failures, newResourceError(describe(i, m.fetchers[i]), err))
+				continue
+			}
+
+			merr.Add(err)
+		}
+
+		// dependents of a failed required resource are not fetched
+		if !merr.Empty() {
+			return merr
+		}
 	}
-	merrmu.Unlock()
 
-	resmu.Lock()
-	for i := 0; i < len(resources); i++ {
-		err := resources[i].ModifyResponse(res)
+	for _, resource := range resources {
+		if resource == nil {
+			continue
+		}
 
-		if err != nil {
+		if err := resource.ModifyResponse(res); err != nil {
 			return err
 		}
 	}
-	resmu.Unlock()
+
+	if len(failures) > 0 {
+		return m.recordFailures(res, failures)
+	}
+
+	return nil
+}
+
+// failedDependency returns a *DependencyError when a dependency of the fetcher
+// i failed without a fallback, or was not fetched itself.
+func (m *MultiFetcher) failedDependency(i int, resources []martian.ResponseModifier, errs []error) error {
+	for _, j := range m.deps[i] {
+		if errs[j] != nil && resources[j] == nil {
+			return &DependencyError{Resource: describe(i, m.fetchers[i]), Dependency: describe(j, m.fetchers[j])}
+		}
+	}
+
+	return nil
+}
+
+// recordFailures adds the failures of optional resources to the response body
+// at m.errorsPath.
+func (m *MultiFetcher) recordFailures(res *http.Response, failures []resourceError) error {
+	original, err := ioutil.ReadAll(res.Body)
+
+	if err != nil {
+		return err
+	}
+
+	res.Body.Close()
+
+	if len(bytes.TrimSpace(original)) == 0 {
+		original = []byte("{}")
+	}
+
+	value, err := json.Marshal(failures)
+
+	if err != nil {
+		return err
+	}
+
+	op, err := json.Marshal([]map[string]interface{}{
+		{"op": "add", "path": m.errorsPath, "value": json.RawMessage(value)},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	patch, err := jsonpatch.DecodePatch(op)
+
+	if err != nil {
+		return err
+	}
+
+	options := jsonpatch.NewApplyOptions()
+	options.EnsurePathExistsOnAdd = true
+
+	modified, err := patch.ApplyWithOptions(original, options)
+
+	if err != nil {
+		return err
+	}
+
+	res.Header.Set("Content-Type", "application/json")
+	res.ContentLength = int64(len(modified))
+	res.Body = ioutil.NopCloser(bytes.NewReader(modified))
 
 	return nil
 }
 
+func newResourceError(resource string, err error) resourceError {
+	re := resourceError{Resource: resource, Message: err.Error()}
+
+	switch err.(type) {
+	case *CircuitOpenError:
+		re.Code = "circuit_open"
+	case *StatusError:
+		re.Code = "upstream_status"
+	case *DependencyError:
+		re.Code = "dependency_failed"
+	}
+
+	return re
+}
+
+func describe(i int, fetcher ResourceFetcher) string {
+	if df, ok := fetcher.(DependentFetcher); ok && df.Name() != "" {
+		return df.Name()
+	}
+
+	if s, ok := fetcher.(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	return fmt.Sprintf("resources[%d]", i)
+}
+
 // ResetResponseVerifications clears all failed response verifications.
 func (m *MultiFetcher) ResetResponseVerifications() {
 	log.Debugf("body.MultiFetcher.ResetResponseVerifications")
@@ -137,7 +399,13 @@ func multiFetcherFromJSON(b []byte) (*parse.Result, error) {
 		}
 	}
 
-	mod := NewMultiFetcher(fetchers)
+	mod, err := NewMultiFetcher(fetchers)
+
+	if err != nil {
+		return nil, err
+	}
+
+	mod.SetErrorsPath(msg.ErrorsPath)
 
 	return parse.NewResult(mod, msg.Scope)
 }
@@ -0,0 +1,251 @@
+package body
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/martian/v3"
+	"github.com/google/martian/v3/proxyutil"
+)
+
+// newNamedResource builds a resource answered by rt, fetching url.
+func newNamedResource(t *testing.T, name, url string, dependsOn []string, rt roundTripFunc) *JSONResource {
+	t.Helper()
+
+	m, err := NewJSONResource("GET", url, "merge", name, nil)
+	if err != nil {
+		t.Fatalf("NewJSONResource(): got %v, want no error", err)
+	}
+
+	m.SetName(name)
+	m.SetDependsOn(dependsOn)
+	m.SetTransport(rt)
+
+	return m
+}
+
+func TestSortFetchers(t *testing.T) {
+	tt := []struct {
+		deps map[string][]string
+		want [][]int
+	}{
+		{
+			deps: map[string][]string{"a": nil, "b": nil, "c": nil},
+			want: [][]int{{0, 1, 2}},
+		},
+		{
+			deps: map[string][]string{"a": nil, "b": {"a"}, "c": {"b"}},
+			want: [][]int{{0}, {1}, {2}},
+		},
+		{
+			deps: map[string][]string{"a": nil, "b": {"a"}, "c": {"a"}, "d": {"b", "c"}},
+			want: [][]int{{0}, {1, 2}, {3}},
+		},
+		{
+			deps: map[string][]string{"a": {"d"}, "b": nil, "c": {"a", "b"}, "d": nil},
+			want: [][]int{{1, 3}, {0}, {2}},
+		},
+	}
+
+	for i, tc := range tt {
+		var fetchers []ResourceFetcher
+
+		for _, name := range []string{"a", "b", "c", "d"} {
+			if deps, ok := tc.deps[name]; ok {
+				fetchers = append(fetchers, newNamedResource(t, name, "http://example.com/"+name, deps, nil))
+			}
+		}
+
+		levels, _, err := sortFetchers(fetchers)
+		if err != nil {
+			t.Fatalf("%d. sortFetchers(): got %v, want no error", i, err)
+		}
+		if !reflect.DeepEqual(levels, tc.want) {
+			t.Errorf("%d. sortFetchers(): got %v, want %v", i, levels, tc.want)
+		}
+	}
+}
+
+func TestSortFetchersErrors(t *testing.T) {
+	tt := []struct {
+		names []string
+		deps  [][]string
+		want  string
+	}{
+		{names: []string{"a", "b"}, deps: [][]string{{"b"}, {"a"}}, want: "dependency cycle between a, b"},
+		{names: []string{"a"}, deps: [][]string{{"a"}}, want: "dependency cycle between a"},
+		{names: []string{"a", "b", "c"}, deps: [][]string{nil, {"c"}, {"b"}}, want: "dependency cycle between b, c"},
+		{names: []string{"a"}, deps: [][]string{{"missing"}}, want: `unknown resource "missing"`},
+		{names: []string{"a", "a"}, deps: [][]string{nil, nil}, want: `duplicate resource name "a"`},
+	}
+
+	for i, tc := range tt {
+		var fetchers []ResourceFetcher
+
+		for j, name := range tc.names {
+			fetchers = append(fetchers, newNamedResource(t, name, "http://example.com/"+name, tc.deps[j], nil))
+		}
+
+		_, err := NewMultiFetcher(fetchers)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%d. NewMultiFetcher(): got %v, want error containing %q", i, err, tc.want)
+		}
+	}
+}
+
+func TestMultiFetcherSkipsDependentsOfFailedResources(t *testing.T) {
+	var mu sync.Mutex
+	var fetched []string
+
+	rt := func(status int, body string) roundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			fetched = append(fetched, req.URL.Path)
+			mu.Unlock()
+
+			return respond(status, body)(req)
+		}
+	}
+
+	user := newNamedResource(t, "user", "http://example.com/user", nil, rt(503, `{}`))
+	user.SetRequired(false)
+
+	team := newNamedResource(t, "team", "http://example.com/teams/{user/team}", []string{"user"}, rt(200, `{"name":"a-team"}`))
+	team.SetRequired(false)
+
+	org := newNamedResource(t, "org", "http://example.com/org", []string{"team"}, rt(200, `{}`))
+	org.SetRequired(false)
+
+	settings := newNamedResource(t, "settings", "http://example.com/settings", nil, rt(200, `{"theme":"dark"}`))
+
+	m, err := NewMultiFetcher([]ResourceFetcher{user, team, org, settings})
+	if err != nil {
+		t.Fatalf("NewMultiFetcher(): got %v, want no error", err)
+	}
+
+	req := newDownstreamRequest(t)
+	res := proxyutil.NewResponse(200, bytes.NewReader([]byte(`{}`)), req)
+
+	if err := m.ModifyResponse(res); err != nil {
+		t.Fatalf("ModifyResponse(): got %v, want no error", err)
+	}
+
+	if want := []string{"/user", "/settings"}; !sameStrings(fetched, want) {
+		t.Errorf("fetched: got %v, want %v", fetched, want)
+	}
+
+	var got struct {
+		Settings map[string]string `json:"settings"`
+		Errors   []resourceError   `json:"_errors"`
+	}
+
+	if err := json.Unmarshal([]byte(readBody(t, res)), &got); err != nil {
+		t.Fatalf("json.Unmarshal(): got %v, want no error", err)
+	}
+
+	if got.Settings["theme"] != "dark" {
+		t.Errorf("settings: got %v, want the settings resource merged", got.Settings)
+	}
+
+	codes := make(map[string]string)
+
+	for _, re := range got.Errors {
+		codes[re.Resource] = re.Code
+	}
+
+	want := map[string]string{"user": "upstream_status", "team": "dependency_failed", "org": "dependency_failed"}
+
+	if !reflect.DeepEqual(codes, want) {
+		t.Errorf("_errors codes: got %v, want %v", codes, want)
+	}
+}
+
+func TestMultiFetcherRequiredDependentOfFailedResource(t *testing.T) {
+	user := newNamedResource(t, "user", "http://example.com/user", nil, respond(503, `{}`))
+	user.SetRequired(false)
+
+	team := newNamedResource(t, "team", "http://example.com/teams/{user/team}", []string{"user"}, respond(200, `{}`))
+
+	m, err := NewMultiFetcher([]ResourceFetcher{user, team})
+	if err != nil {
+		t.Fatalf("NewMultiFetcher(): got %v, want no error", err)
+	}
+
+	req := newDownstreamRequest(t)
+	res := proxyutil.NewResponse(200, bytes.NewReader([]byte(`{}`)), req)
+
+	err = m.ModifyResponse(res)
+
+	var derr *DependencyError
+	if !errors.As(unwrapSingle(err), &derr) {
+		t.Fatalf("ModifyResponse(): got %v, want *DependencyError", err)
+	}
+	if derr.Resource != "team" || derr.Dependency != "user" {
+		t.Errorf("DependencyError: got %s depending on %s, want team depending on user", derr.Resource, derr.Dependency)
+	}
+}
+
+func TestMultiFetcherFallbackResolvesDependents(t *testing.T) {
+	var path string
+
+	user := newNamedResource(t, "user", "http://example.com/user", nil, respond(503, `{}`))
+	user.SetFallback([]byte(`{"team":"guests"}`))
+
+	team := newNamedResource(t, "team", "http://example.com/teams/{user/team}", []string{"user"}, func(req *http.Request) (*http.Response, error) {
+		path = req.URL.Path
+		return respond(200, `{}`)(req)
+	})
+
+	m, err := NewMultiFetcher([]ResourceFetcher{user, team})
+	if err != nil {
+		t.Fatalf("NewMultiFetcher(): got %v, want no error", err)
+	}
+
+	req := newDownstreamRequest(t)
+	res := proxyutil.NewResponse(200, bytes.NewReader([]byte(`{}`)), req)
+
+	if err := m.ModifyResponse(res); err != nil {
+		t.Fatalf("ModifyResponse(): got %v, want no error", err)
+	}
+
+	if want := "/teams/guests"; path != want {
+		t.Errorf("team path: got %q, want %q", path, want)
+	}
+}
+
+func sameStrings(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+
+	seen := make(map[string]int)
+
+	for _, s := range got {
+		seen[s]++
+	}
+
+	for _, s := range want {
+		if seen[s] == 0 {
+			return false
+		}
+
+		seen[s]--
+	}
+
+	return true
+}
+
+// unwrapSingle returns the error of a *martian.MultiError holding a single one.
+func unwrapSingle(err error) error {
+	if merr, ok := err.(*martian.MultiError); ok && len(merr.Errors()) == 1 {
+		return merr.Errors()[0]
+	}
+
+	return err
+}
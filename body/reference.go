@@ -0,0 +1,240 @@
+package body
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/martian/v3"
+)
+
+// references have the form {name/json/pointer} where name is either the name of
+// a resource fetched earlier or one of the sources of the incoming request
+// below, and the rest is a JSON pointer into it. {name} refers to the whole
+// resource result.
+var (
+	referenceRe       = regexp.MustCompile(`\{([A-Za-z0-9_-]+)((?:/[^{}"\s/]*)*)\}`)
+	quotedReferenceRe = regexp.MustCompile(`"\{([A-Za-z0-9_-]+)((?:/[^{}"\s/]*)*)\}"`)
+)
+
+// sources of the incoming request, they can't be used as resource names
+const (
+	paramsSource  = "params"
+	querySource   = "query"
+	headersSource = "headers"
+	bodySource    = "body"
+)
+
+func reservedName(name string) bool {
+	return name == paramsSource || name == querySource || name == headersSource || name == bodySource
+}
+
+func resourceKey(name string) string {
+	return "body.JSONResource." + name
+}
+
+// setResult records the result of a named resource in the martian context of
+// the downstream request so that dependent resources can reference it.
+func setResult(ctx *martian.Context, name string, body []byte) {
+	if ctx != nil && name != "" {
+		ctx.Set(resourceKey(name), body)
+	}
+}
+
+// lookupReference returns the value referenced by name and pointer for the
+// downstream request.
+func lookupReference(req *http.Request, name, pointer string) (interface{}, error) {
+	ctx := martian.NewContext(req)
+	token := strings.TrimPrefix(pointer, "/")
+
+	switch name {
+	case paramsSource:
+		if val, ok := ctx.Get("bffurl.ParamName." + token); ok {
+			return val, nil
+		}
+
+		return nil, fmt.Errorf("body.JSONResource: unresolved reference to path param %q", token)
+	case querySource:
+		if values, ok := req.URL.Query()[token]; ok && len(values) > 0 {
+			return values[0], nil
+		}
+
+		return nil, fmt.Errorf("body.JSONResource: unresolved reference to query param %q", token)
+	case headersSource:
+		if values, ok := req.Header[http.CanonicalHeaderKey(token)]; ok && len(values) > 0 {
+			return values[0], nil
+		}
+
+		return nil, fmt.Errorf("body.JSONResource: unresolved reference to header %q", token)
+	}
+
+	var body interface{}
+
+	if ctx != nil {
+		if name == bodySource {
+			body, _ = ctx.Get(requestBodyKey)
+		} else {
+			body, _ = ctx.Get(resourceKey(name))
+		}
+	}
+
+	raw, ok := body.([]byte)
+
+	if !ok {
+		return nil, fmt.Errorf("body.JSONResource: unresolved reference to %q", name)
+	}
+
+	var doc interface{}
+
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("body.JSONResource: %q is not JSON: %v", name, err)
+	}
+
+	return lookupPointer(doc, name, pointer)
+}
+
+// lookupPointer walks a JSON pointer in an unmarshalled document.
+func lookupPointer(doc interface{}, name, pointer string) (interface{}, error) {
+	if pointer == "" {
+		return doc, nil
+	}
+
+	unescape := strings.NewReplacer("~1", "/", "~0", "~")
+
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = unescape.Replace(token)
+
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			var ok bool
+
+			if doc, ok = node[token]; !ok {
+				return nil, fmt.Errorf("body.JSONResource: reference {%s%s} not found", name, pointer)
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, fmt.Errorf("body.JSONResource: reference {%s%s} not found", name, pointer)
+			}
+
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("body.JSONResource: reference {%s%s} not found", name, pointer)
+		}
+	}
+
+	return doc, nil
+}
+
+// hasReference returns whether s contains any reference.
+func hasReference(s string) bool {
+	return referenceRe.MatchString(s)
+}
+
+// referencesSource returns whether s contains a reference to source.
+func referencesSource(s, source string) bool {
+	for _, match := range referenceRe.FindAllStringSubmatch(s, -1) {
+		if match[1] == source {
+			return true
+		}
+	}
+
+	return false
+}
+
+// escapeTemplate escapes the literal parts of a template, leaving the
+// references intact.
+func escapeTemplate(s string, escape func(string) string) string {
+	var b strings.Builder
+	n := 0
+
+	for _, loc := range referenceRe.FindAllStringIndex(s, -1) {
+		b.WriteString(escape(s[n:loc[0]]))
+		b.WriteString(s[loc[0]:loc[1]])
+		n = loc[1]
+	}
+
+	b.WriteString(escape(s[n:]))
+
+	return b.String()
+}
+
+// resolveString replaces every reference in s with the string form of the
+// referenced value passed through escape.
+func resolveString(req *http.Request, s string, escape func(string) string) (string, error) {
+	var rerr error
+
+	resolved := referenceRe.ReplaceAllStringFunc(s, func(ref string) string {
+		match := referenceRe.FindStringSubmatch(ref)
+		value, err := lookupReference(req, match[1], match[2])
+
+		if err != nil {
+			rerr = err
+			return ref
+		}
+
+		if str, ok := value.(string); ok {
+			return escape(str)
+		}
+
+		raw, _ := json.Marshal(value)
+
+		return escape(string(raw))
+	})
+
+	return resolved, rerr
+}
+
+// resolveJSON replaces references in a JSON template. A string consisting of a
+// single reference is replaced by the referenced JSON value, references
+// embedded in longer strings are replaced by the string form of the value.
+func resolveJSON(req *http.Request, template []byte) ([]byte, error) {
+	var rerr error
+
+	resolved := quotedReferenceRe.ReplaceAllFunc(template, func(ref []byte) []byte {
+		match := quotedReferenceRe.FindSubmatch(ref)
+		value, err := lookupReference(req, string(match[1]), string(match[2]))
+
+		if err != nil {
+			rerr = err
+			return ref
+		}
+
+		raw, _ := json.Marshal(value)
+
+		// mark the value so that it is not resolved again below
+		return append([]byte{0}, append(raw, 0)...)
+	})
+
+	if rerr != nil {
+		return nil, rerr
+	}
+
+	// resolve the remaining references outside of the substituted values
+	var b bytes.Buffer
+
+	for i, part := range bytes.Split(resolved, []byte{0}) {
+		if i%2 == 1 {
+			b.Write(part)
+			continue
+		}
+
+		str, err := resolveString(req, string(part), func(s string) string {
+			raw, _ := json.Marshal(s)
+			return string(raw[1 : len(raw)-1])
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		b.WriteString(str)
+	}
+
+	return b.Bytes(), nil
+}
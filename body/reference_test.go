@@ -0,0 +1,208 @@
+package body
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/martian/v3"
+)
+
+// newReferenceRequest returns a downstream request with a path param, a
+// recorded body and the results of the user and items resources.
+func newReferenceRequest(t *testing.T) *http.Request {
+	t.Helper()
+
+	req, err := http.NewRequest("POST", "http://example.com/users/42?page=2&tag=a%20b", bytes.NewReader([]byte(`{"order":{"id":7}}`)))
+	if err != nil {
+		t.Fatalf("http.NewRequest(): got %v, want no error", err)
+	}
+	req.Header.Set("X-Tenant", "acme")
+
+	ctx, remove, err := martian.TestContext(req, nil, nil)
+	if err != nil {
+		t.Fatalf("martian.TestContext(): got %v, want no error", err)
+	}
+	t.Cleanup(remove)
+
+	if err := NewRequestBodyRecorder().ModifyRequest(req); err != nil {
+		t.Fatalf("RequestBodyRecorder.ModifyRequest(): got %v, want no error", err)
+	}
+
+	ctx.Set("bffurl.ParamName.id", "42")
+	setResult(ctx, "user", []byte(`{"name":"Jane Doe","team":{"id":3},"a/b":1,"m~n":2,"admin":true}`))
+	setResult(ctx, "items", []byte(`[{"sku":"x1"},{"sku":"y2"}]`))
+
+	return req
+}
+
+func TestLookupReference(t *testing.T) {
+	req := newReferenceRequest(t)
+
+	tt := []struct {
+		name    string
+		pointer string
+		want    interface{}
+	}{
+		{name: "params", pointer: "/id", want: "42"},
+		{name: "query", pointer: "/page", want: "2"},
+		{name: "query", pointer: "/tag", want: "a b"},
+		{name: "headers", pointer: "/x-tenant", want: "acme"},
+		{name: "body", pointer: "/order/id", want: float64(7)},
+		{name: "user", pointer: "/name", want: "Jane Doe"},
+		{name: "user", pointer: "/team/id", want: float64(3)},
+		{name: "user", pointer: "/a~1b", want: float64(1)},
+		{name: "user", pointer: "/m~0n", want: float64(2)},
+		{name: "items", pointer: "/1/sku", want: "y2"},
+	}
+
+	for i, tc := range tt {
+		got, err := lookupReference(req, tc.name, tc.pointer)
+		if err != nil {
+			t.Fatalf("%d. lookupReference(%s, %s): got %v, want no error", i, tc.name, tc.pointer, err)
+		}
+		if got != tc.want {
+			t.Errorf("%d. lookupReference(%s, %s): got %#v, want %#v", i, tc.name, tc.pointer, got, tc.want)
+		}
+	}
+}
+
+func TestLookupReferenceErrors(t *testing.T) {
+	req := newReferenceRequest(t)
+
+	tt := []struct {
+		name    string
+		pointer string
+	}{
+		{name: "params", pointer: "/missing"},
+		{name: "query", pointer: "/missing"},
+		{name: "headers", pointer: "/missing"},
+		{name: "team", pointer: "/id"},
+		{name: "user", pointer: "/missing"},
+		{name: "user", pointer: "/name/first"},
+		{name: "items", pointer: "/2"},
+		{name: "items", pointer: "/-1"},
+		{name: "items", pointer: "/sku"},
+	}
+
+	for i, tc := range tt {
+		if got, err := lookupReference(req, tc.name, tc.pointer); err == nil {
+			t.Errorf("%d. lookupReference(%s, %s): got %#v, want error", i, tc.name, tc.pointer, got)
+		}
+	}
+}
+
+func TestResolveString(t *testing.T) {
+	req := newReferenceRequest(t)
+	noescape := func(s string) string { return s }
+
+	tt := []struct {
+		template string
+		escape   func(string) string
+		want     string
+	}{
+		{template: "no references", escape: noescape, want: "no references"},
+		{template: "{user/name}", escape: noescape, want: "Jane Doe"},
+		{template: "Bearer {headers/x-tenant}-{params/id}", escape: noescape, want: "Bearer acme-42"},
+		{template: "{user/team}", escape: noescape, want: `{"id":3}`},
+		{template: "{user/admin}", escape: noescape, want: "true"},
+		{template: "/teams/{user/name}", escape: url.PathEscape, want: "/teams/Jane%20Doe"},
+		{template: "q={user/name}&id={params/id}", escape: url.QueryEscape, want: "q=Jane+Doe&id=42"},
+	}
+
+	for i, tc := range tt {
+		got, err := resolveString(req, tc.template, tc.escape)
+		if err != nil {
+			t.Fatalf("%d. resolveString(%q): got %v, want no error", i, tc.template, err)
+		}
+		if got != tc.want {
+			t.Errorf("%d. resolveString(%q): got %q, want %q", i, tc.template, got, tc.want)
+		}
+	}
+
+	if _, err := resolveString(req, "/teams/{team/id}", url.PathEscape); err == nil {
+		t.Errorf("resolveString(%q): got no error, want unresolved reference", "/teams/{team/id}")
+	}
+}
+
+func TestResolveJSON(t *testing.T) {
+	req := newReferenceRequest(t)
+
+	tt := []struct {
+		template string
+		want     string
+	}{
+		{template: `{"id":"{params/id}"}`, want: `{"id":"42"}`},
+		{template: `{"team":"{user/team}"}`, want: `{"team":{"id":3}}`},
+		{template: `{"items":"{items}"}`, want: `{"items":[{"sku":"x1"},{"sku":"y2"}]}`},
+		{template: `{"admin":"{user/admin}"}`, want: `{"admin":true}`},
+		{template: `{"greeting":"hi {user/name}, order {body/order/id}"}`, want: `{"greeting":"hi Jane Doe, order 7"}`},
+		{template: `{"quoted":"say \"{user/team}\""}`, want: `{"quoted":"say \"{\"id\":3}\""}`},
+	}
+
+	for i, tc := range tt {
+		got, err := resolveJSON(req, []byte(tc.template))
+		if err != nil {
+			t.Fatalf("%d. resolveJSON(%s): got %v, want no error", i, tc.template, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("%d. resolveJSON(%s): got %s, want %s", i, tc.template, got, tc.want)
+		}
+	}
+
+	if _, err := resolveJSON(req, []byte(`{"team":"{team}"}`)); err == nil {
+		t.Errorf("resolveJSON(): got no error, want unresolved reference")
+	}
+}
+
+func TestEscapeTemplate(t *testing.T) {
+	got := escapeTemplate("/a b/{user/name}/c d", strings.ToUpper)
+
+	if want := "/A B/{user/name}/C D"; got != want {
+		t.Errorf("escapeTemplate(): got %q, want %q", got, want)
+	}
+}
+
+func TestNewUpstreamRequestTemplates(t *testing.T) {
+	req := newReferenceRequest(t)
+
+	m, err := NewJSONResource("POST", "http://example.com/teams/{user/team/id}/members/:id?tenant={headers/x-tenant}", "", "", nil)
+	if err != nil {
+		t.Fatalf("NewJSONResource(): got %v, want no error", err)
+	}
+
+	m.SetQuery(map[string]string{"owner": "{user/name}"})
+	m.SetHeaders(map[string]string{"X-Order": "{body/order/id}"})
+	m.SetBody([]byte(`{"user":"{user}","sku":"{items/0/sku}"}`))
+
+	upstream, err := m.newUpstreamRequest(req)
+	if err != nil {
+		t.Fatalf("newUpstreamRequest(): got %v, want no error", err)
+	}
+
+	if got, want := upstream.URL.Path, "/teams/3/members/42"; got != want {
+		t.Errorf("upstream.URL.Path: got %q, want %q", got, want)
+	}
+	if got, want := upstream.URL.Query().Get("tenant"), "acme"; got != want {
+		t.Errorf("query tenant: got %q, want %q", got, want)
+	}
+	if got, want := upstream.URL.Query().Get("owner"), "Jane Doe"; got != want {
+		t.Errorf("query owner: got %q, want %q", got, want)
+	}
+	if got, want := upstream.Header.Get("X-Order"), "7"; got != want {
+		t.Errorf("upstream.Header.Get(%q): got %q, want %q", "X-Order", got, want)
+	}
+
+	body, err := ioutil.ReadAll(upstream.Body)
+	if err != nil {
+		t.Fatalf("ioutil.ReadAll(): got %v, want no error", err)
+	}
+
+	// a whole referenced value is marshalled again, with its keys sorted
+	if want := `{"user":{"a/b":1,"admin":true,"m~n":2,"name":"Jane Doe","team":{"id":3}},"sku":"x1"}`; string(body) != want {
+		t.Errorf("upstream.Body: got %s, want %s", body, want)
+	}
+}
@@ -0,0 +1,78 @@
+package body
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/martian/v3"
+)
+
+const (
+	requestBodyKey     = "body.RequestBody"
+	maxRecordedRequest = 1 << 20
+)
+
+var (
+	trackMu        sync.Mutex
+	bodyReferenced int32
+)
+
+// TrackBodyReferences starts recording whether the resources parsed reference
+// the request body, the returned func stops and reports it. Tracks are
+// serialized, the request body only needs recording when one does.
+func TrackBodyReferences() func() bool {
+	trackMu.Lock()
+	atomic.StoreInt32(&bodyReferenced, 0)
+
+	return func() bool {
+		defer trackMu.Unlock()
+
+		return atomic.LoadInt32(&bodyReferenced) == 1
+	}
+}
+
+func trackBodyReference() {
+	atomic.StoreInt32(&bodyReferenced, 1)
+}
+
+// RequestBodyRecorder keeps a copy of the incoming request body in the martian
+// context, JSONResource templates reference it as {body/json/pointer} once the
+// request has already been sent upstream. Bodies over 1MiB are not recorded.
+type RequestBodyRecorder struct{}
+
+// NewRequestBodyRecorder returns a RequestBodyRecorder.
+func NewRequestBodyRecorder() *RequestBodyRecorder {
+	return &RequestBodyRecorder{}
+}
+
+// ModifyRequest records the request body.
+func (r *RequestBodyRecorder) ModifyRequest(req *http.Request) error {
+	if req.Body == nil || req.Body == http.NoBody || req.ContentLength > maxRecordedRequest {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, maxRecordedRequest+1))
+
+	if err != nil {
+		return err
+	}
+
+	req.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+
+	if len(body) > maxRecordedRequest {
+		return nil
+	}
+
+	if ctx := martian.NewContext(req); ctx != nil {
+		ctx.Set(requestBodyKey, body)
+	}
+
+	return nil
+}
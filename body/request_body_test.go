@@ -0,0 +1,37 @@
+package body
+
+import (
+	"testing"
+
+	"github.com/google/martian/v3/parse"
+)
+
+func TestTrackBodyReferences(t *testing.T) {
+	tt := []struct {
+		resource string
+		want     bool
+	}{
+		{resource: `"url": "http://example.com/users/:id"`},
+		{resource: `"url": "http://example.com/users/{params/id}", "headers": {"X-Tenant": "{headers/x-tenant}"}`},
+		{resource: `"url": "http://example.com/users/{body/user/id}"`, want: true},
+		{resource: `"url": "http://example.com/users?team={body/team}"`, want: true},
+		{resource: `"url": "http://example.com/users", "query": {"team": "{body/team}"}`, want: true},
+		{resource: `"url": "http://example.com/users", "headers": {"X-Team": "{body/team}"}`, want: true},
+		{resource: `"url": "http://example.com/users", "method": "POST", "body": {"user": "{body}"}`, want: true},
+	}
+
+	for i, tc := range tt {
+		referencesBody := TrackBodyReferences()
+
+		_, err := parse.FromJSON([]byte(`{"body.JSONResource": {"scope": ["response"], ` + tc.resource + `}}`))
+		got := referencesBody()
+
+		if err != nil {
+			t.Fatalf("%d. parse.FromJSON(): got %v, want no error", i, err)
+		}
+
+		if got != tc.want {
+			t.Errorf("%d. TrackBodyReferences(%s): got %t, want %t", i, tc.resource, got, tc.want)
+		}
+	}
+}
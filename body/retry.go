@@ -0,0 +1,148 @@
+package body
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultBackoff    = 100 * time.Millisecond
+	defaultMaxBackoff = 2 * time.Second
+)
+
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// RetryOn lists the failures a fetch is retried on. In JSON it is a list of
+// status codes and "network" for transport errors, including timeouts.
+type RetryOn struct {
+	StatusCodes []int
+	Network     bool
+}
+
+// UnmarshalJSON parses a list such as [502, 503, "network"].
+func (r *RetryOn) UnmarshalJSON(b []byte) error {
+	var values []interface{}
+
+	if err := json.Unmarshal(b, &values); err != nil {
+		return err
+	}
+
+	for _, value := range values {
+		switch v := value.(type) {
+		case float64:
+			r.StatusCodes = append(r.StatusCodes, int(v))
+		case string:
+			if v == "network" {
+				r.Network = true
+				continue
+			}
+
+			code, err := strconv.Atoi(v)
+
+			if err != nil {
+				return fmt.Errorf("body.JSONResource: invalid retryOn %q", v)
+			}
+
+			r.StatusCodes = append(r.StatusCodes, code)
+		default:
+			return fmt.Errorf("body.JSONResource: invalid retryOn %v", v)
+		}
+	}
+
+	return nil
+}
+
+func (r *RetryOn) empty() bool {
+	return len(r.StatusCodes) == 0 && !r.Network
+}
+
+// RetryPolicy controls how many times and on which failures a JSONResource
+// fetch is retried, waiting an exponential backoff with full jitter between
+// attempts.
+type RetryPolicy struct {
+	Retries    int
+	RetryOn    RetryOn
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// NonIdempotent allows retrying methods such as POST and PATCH.
+	NonIdempotent bool
+}
+
+// NewRetryPolicy returns a RetryPolicy, an empty retryOn defaults to network
+// errors, 502, 503 and 504.
+func NewRetryPolicy(retries int, retryOn RetryOn, backoff, maxBackoff time.Duration, nonIdempotent bool) *RetryPolicy {
+	if retryOn.empty() {
+		retryOn = RetryOn{
+			StatusCodes: []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+			Network:     true,
+		}
+	}
+
+	if backoff <= 0 {
+		backoff = defaultBackoff
+	}
+
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+
+	return &RetryPolicy{
+		Retries:       retries,
+		RetryOn:       retryOn,
+		Backoff:       backoff,
+		MaxBackoff:    maxBackoff,
+		NonIdempotent: nonIdempotent,
+	}
+}
+
+// attempts returns how many times a request with the given method is sent.
+func (p *RetryPolicy) attempts(method string) int {
+	if p == nil || p.Retries <= 0 {
+		return 1
+	}
+
+	if !p.NonIdempotent && !idempotentMethods[method] {
+		return 1
+	}
+
+	return p.Retries + 1
+}
+
+// retryable returns whether the outcome of an attempt should be retried.
+func (p *RetryPolicy) retryable(res *http.Response, err error) bool {
+	if err != nil {
+		return p.RetryOn.Network
+	}
+
+	for _, code := range p.RetryOn.StatusCodes {
+		if res.StatusCode == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// backoff returns the wait before the given retry, starting at 1.
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	ceil := p.MaxBackoff
+
+	if shift := retry - 1; shift < 32 {
+		if exp := p.Backoff << uint(shift); exp > 0 && exp < ceil {
+			ceil = exp
+		}
+	}
+
+	return time.Duration(rand.Int63n(int64(ceil) + 1))
+}
@@ -0,0 +1,202 @@
+package body
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/martian/v3/proxyutil"
+)
+
+// roundTripFunc answers upstream requests of the resources under test.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRetryOnUnmarshalJSON(t *testing.T) {
+	var got RetryOn
+	if err := json.Unmarshal([]byte(`[502, "503", "network"]`), &got); err != nil {
+		t.Fatalf("json.Unmarshal(): got %v, want no error", err)
+	}
+
+	want := RetryOn{StatusCodes: []int{502, 503}, Network: true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("json.Unmarshal(): got %+v, want %+v", got, want)
+	}
+
+	for i, raw := range []string{`["timeout"]`, `[true]`, `"network"`} {
+		var r RetryOn
+		if err := json.Unmarshal([]byte(raw), &r); err == nil {
+			t.Errorf("%d. json.Unmarshal(%s): got no error, want error", i, raw)
+		}
+	}
+}
+
+func TestNewRetryPolicyDefaults(t *testing.T) {
+	p := NewRetryPolicy(2, RetryOn{}, 0, 0, false)
+
+	if !p.RetryOn.Network {
+		t.Errorf("p.RetryOn.Network: got false, want true")
+	}
+	if got, want := p.RetryOn.StatusCodes, []int{502, 503, 504}; !reflect.DeepEqual(got, want) {
+		t.Errorf("p.RetryOn.StatusCodes: got %v, want %v", got, want)
+	}
+	if p.Backoff != defaultBackoff || p.MaxBackoff != defaultMaxBackoff {
+		t.Errorf("p.Backoff, p.MaxBackoff: got %s, %s, want %s, %s", p.Backoff, p.MaxBackoff, defaultBackoff, defaultMaxBackoff)
+	}
+}
+
+func TestRetryPolicyAttempts(t *testing.T) {
+	tt := []struct {
+		policy *RetryPolicy
+		method string
+		want   int
+	}{
+		{policy: nil, method: "GET", want: 1},
+		{policy: NewRetryPolicy(2, RetryOn{}, 0, 0, false), method: "GET", want: 3},
+		{policy: NewRetryPolicy(2, RetryOn{}, 0, 0, false), method: "PUT", want: 3},
+		{policy: NewRetryPolicy(2, RetryOn{}, 0, 0, false), method: "POST", want: 1},
+		{policy: NewRetryPolicy(2, RetryOn{}, 0, 0, false), method: "PATCH", want: 1},
+		{policy: NewRetryPolicy(2, RetryOn{}, 0, 0, true), method: "POST", want: 3},
+	}
+
+	for i, tc := range tt {
+		if got := tc.policy.attempts(tc.method); got != tc.want {
+			t.Errorf("%d. attempts(%s): got %d, want %d", i, tc.method, got, tc.want)
+		}
+	}
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	p := NewRetryPolicy(1, RetryOn{StatusCodes: []int{503}}, 0, 0, false)
+
+	tt := []struct {
+		code int
+		err  error
+		want bool
+	}{
+		{code: 503, want: true},
+		{code: 502, want: false},
+		{code: 200, want: false},
+		{err: errors.New("connection refused"), want: false},
+	}
+
+	for i, tc := range tt {
+		var res *http.Response
+		if tc.err == nil {
+			res = proxyutil.NewResponse(tc.code, nil, nil)
+		}
+
+		if got := p.retryable(res, tc.err); got != tc.want {
+			t.Errorf("%d. retryable(%d, %v): got %t, want %t", i, tc.code, tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestRetryPolicyBackoffBounds(t *testing.T) {
+	p := NewRetryPolicy(10, RetryOn{}, 10*time.Millisecond, 50*time.Millisecond, false)
+
+	tt := []struct {
+		retry int
+		max   time.Duration
+	}{
+		{retry: 1, max: 10 * time.Millisecond},
+		{retry: 2, max: 20 * time.Millisecond},
+		{retry: 3, max: 40 * time.Millisecond},
+		{retry: 4, max: 50 * time.Millisecond},
+		{retry: 40, max: 50 * time.Millisecond},
+	}
+
+	for i, tc := range tt {
+		for n := 0; n < 100; n++ {
+			if got := p.backoff(tc.retry); got < 0 || got > tc.max {
+				t.Fatalf("%d. backoff(%d): got %s, want between 0 and %s", i, tc.retry, got, tc.max)
+			}
+		}
+	}
+}
+
+func TestSendWithRetries(t *testing.T) {
+	m, err := NewJSONResource("GET", "http://example.com/resource", "", "", nil)
+	if err != nil {
+		t.Fatalf("NewJSONResource(): got %v, want no error", err)
+	}
+
+	m.SetRetryPolicy(NewRetryPolicy(2, RetryOn{}, time.Millisecond, time.Millisecond, false))
+
+	var attempts int
+	m.SetTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+
+		if attempts < 3 {
+			return proxyutil.NewResponse(503, nil, req), nil
+		}
+
+		return proxyutil.NewResponse(200, nil, req), nil
+	}))
+
+	req, err := http.NewRequest("GET", "http://example.com/resource", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest(): got %v, want no error", err)
+	}
+
+	res, err := m.sendWithRetries(req, nil)
+	if err != nil {
+		t.Fatalf("sendWithRetries(): got %v, want no error", err)
+	}
+	if got, want := res.StatusCode, 200; got != want {
+		t.Errorf("res.StatusCode: got %d, want %d", got, want)
+	}
+	if got, want := attempts, 3; got != want {
+		t.Errorf("attempts: got %d, want %d", got, want)
+	}
+}
+
+func TestSendWithRetriesCanceled(t *testing.T) {
+	m, err := NewJSONResource("GET", "http://example.com/resource", "", "", nil)
+	if err != nil {
+		t.Fatalf("NewJSONResource(): got %v, want no error", err)
+	}
+
+	m.SetRetryPolicy(NewRetryPolicy(5, RetryOn{}, time.Hour, time.Hour, false))
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var attempts int
+	m.SetTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		cancel()
+
+		return proxyutil.NewResponse(503, nil, req), nil
+	}))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://example.com/resource", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequestWithContext(): got %v, want no error", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.sendWithRetries(req, nil)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("sendWithRetries(): got %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("sendWithRetries(): still backing off after the request was canceled")
+	}
+
+	if got, want := attempts, 1; got != want {
+		t.Errorf("attempts: got %d, want %d", got, want)
+	}
+}
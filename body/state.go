@@ -0,0 +1,21 @@
+package body
+
+import "sync/atomic"
+
+// generation is bumped by Reset, caches and circuit breakers of an older
+// generation drop their state on next use.
+var generation int64
+
+// Reset drops every cached resource response and closes every circuit breaker,
+// so that runs sharing a modifier stack do not observe each other's upstreams.
+func Reset() {
+	atomic.AddInt64(&generation, 1)
+
+	circuits.Lock()
+	circuits.breakers = make(map[string]*CircuitBreaker)
+	circuits.Unlock()
+}
+
+func currentGeneration() int64 {
+	return atomic.LoadInt64(&generation)
+}
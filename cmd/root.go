@@ -5,8 +5,8 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 
-	"github.com/fsnotify/fsnotify"
 	"github.com/imranismail/bff/config"
 	"github.com/imranismail/bff/log"
 	"github.com/imranismail/bff/proxy"
@@ -17,6 +17,7 @@ import (
 )
 
 var cfgFile string
+var cfgErr error
 var cfgPath = path.Join(xdg.ConfigHome, "bff")
 
 // rootCmd represents the base command when called without any subcommands
@@ -52,6 +53,12 @@ func init() {
 	rootCmd.Flags().StringP("port", "p", "5000", "Port to run the server on")
 	viper.BindPFlag("port", rootCmd.Flags().Lookup("port"))
 
+	rootCmd.Flags().String("admin-port", "", "Port to serve the admin endpoints on, disabled when empty")
+	viper.BindPFlag("adminPort", rootCmd.Flags().Lookup("admin-port"))
+
+	rootCmd.Flags().String("admin-address", "127.0.0.1", "Address to bind the admin endpoints to")
+	viper.BindPFlag("adminAddress", rootCmd.Flags().Lookup("admin-address"))
+
 	rootCmd.Flags().BoolP("insecure", "i", false, "Skip TLS verify")
 	viper.BindPFlag("insecure", rootCmd.Flags().Lookup("insecure"))
 
@@ -61,9 +68,33 @@ func init() {
 	rootCmd.Flags().BoolP("pretty", "r", false, "Pretty logs")
 	viper.BindPFlag("pretty", rootCmd.Flags().Lookup("pretty"))
 
-	rootCmd.Flags().StringP("url", "u", "", "Proxied URL")
+	rootCmd.Flags().StringP("url", "u", "", "Downstream proxy url of the upstream requests")
 	viper.BindPFlag("url", rootCmd.Flags().Lookup("url"))
 
+	rootCmd.Flags().String("upstream", "", "Upstream URL of the requests bff receives as an origin server")
+	viper.BindPFlag("upstream", rootCmd.Flags().Lookup("upstream"))
+
+	rootCmd.Flags().StringSlice("trusted-proxies", nil, "Addresses and CIDR ranges of the proxies whose X-Forwarded headers are kept")
+	viper.BindPFlag("trustedProxies", rootCmd.Flags().Lookup("trusted-proxies"))
+
+	rootCmd.Flags().Duration("drain-delay", 5*time.Second, "Time to keep serving with a failing healthcheck before draining on shutdown")
+	viper.BindPFlag("drainDelay", rootCmd.Flags().Lookup("drain-delay"))
+
+	rootCmd.Flags().Duration("drain-timeout", 30*time.Second, "Time to wait for in-flight requests on shutdown")
+	viper.BindPFlag("drainTimeout", rootCmd.Flags().Lookup("drain-timeout"))
+
+	rootCmd.Flags().Bool("hide-error-details", false, "Leave error messages out of error responses")
+	viper.BindPFlag("hideErrorDetails", rootCmd.Flags().Lookup("hide-error-details"))
+
+	rootCmd.Flags().String("tls-cert", "", "Certificate file to terminate TLS with, TLS is disabled when empty")
+	viper.BindPFlag("tls.certFile", rootCmd.Flags().Lookup("tls-cert"))
+
+	rootCmd.Flags().String("tls-key", "", "Private key file of the TLS certificate")
+	viper.BindPFlag("tls.keyFile", rootCmd.Flags().Lookup("tls-key"))
+
+	rootCmd.Flags().String("tls-client-ca", "", "CA file to verify client certificates with")
+	viper.BindPFlag("tls.clientCAFile", rootCmd.Flags().Lookup("tls-client-ca"))
+
 	if hasPipedInput() {
 		b, err := ioutil.ReadAll(os.Stdin)
 
@@ -89,20 +120,24 @@ func initConfig() {
 	viper.AutomaticEnv()
 
 	err := viper.ReadInConfig()
+	cfgErr = err
 
 	// If a config file is found, read it in
 	if err == nil {
-		log.Configure()
+		if err := log.Configure(); err != nil {
+			log.Errorf("%v", err)
+			os.Exit(1)
+		}
+
 		log.Infof("Using config file: %v", viper.ConfigFileUsed())
 	}
 
-	viper.OnConfigChange(func(evt fsnotify.Event) {
-		log.Infof("Reconfiguring: %v", evt.Name)
-		log.Configure()
-		proxy.Configure()
-	})
-
-	viper.WatchConfig()
+	// reloads are serialized with the ones of the admin API
+	if err == nil {
+		if err := proxy.WatchConfig(viper.ConfigFileUsed()); err != nil {
+			log.Errorf("%v", err)
+		}
+	}
 }
 
 func hasPipedInput() bool {
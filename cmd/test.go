@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/imranismail/bff/fixture"
+	"github.com/imranismail/bff/proxy"
+	"github.com/spf13/cobra"
+)
+
+// testCmd runs request/response fixtures against the configured modifiers
+var testCmd = &cobra.Command{
+	Use:   "test FIXTURES",
+	Short: "Run request/response fixtures against the modifiers config",
+	Long: `
+Sends every fixture request through the configured modifiers in-process,
+answering upstream requests with the canned responses of the fixture, and
+reports every response that does not match the expectation.`,
+	Args: cobra.ExactArgs(1),
+	Run:  test,
+}
+
+func init() {
+	rootCmd.AddCommand(testCmd)
+}
+
+func test(cmd *cobra.Command, args []string) {
+	raw, err := ioutil.ReadFile(args[0])
+
+	if err != nil {
+		cmd.PrintErrf("fixtures: %v\n", err)
+		os.Exit(1)
+	}
+
+	fixtures, err := fixture.Load(raw)
+
+	if err != nil {
+		cmd.PrintErrf("fixtures: %v\n", err)
+		os.Exit(1)
+	}
+
+	eb, err := proxy.NewBoundary()
+
+	if err != nil {
+		cmd.PrintErrf("modifiers: %v\n", err)
+		os.Exit(1)
+	}
+
+	out := cmd.OutOrStdout()
+	failed := 0
+
+	for i := range fixtures {
+		f := &fixtures[i]
+
+		name := f.Name
+
+		if name == "" {
+			name = fmt.Sprintf("fixtures[%d]", i)
+		}
+
+		failures, err := fixture.Run(f, eb)
+
+		if err != nil {
+			failures = append(failures, err.Error())
+		}
+
+		if len(failures) == 0 {
+			fmt.Fprintf(out, "PASS %s\n", name)
+			continue
+		}
+
+		failed++
+
+		fmt.Fprintf(out, "FAIL %s\n", name)
+
+		for _, failure := range failures {
+			fmt.Fprintf(out, "    %s\n", strings.ReplaceAll(failure, "\n", "\n    "))
+		}
+	}
+
+	fmt.Fprintf(out, "%d passed, %d failed\n", len(fixtures)-failed, failed)
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/google/martian/v3"
+	"github.com/imranismail/bff/proxy"
+	"github.com/imranismail/bff/transport"
+	"github.com/imranismail/bff/upstream"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// validateCmd checks the modifiers config without starting the proxy
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the modifiers config",
+	Long: `
+Parses every configured modifier and reports all the invalid entries
+without starting the proxy. Exits with a non-zero status on failure.`,
+	Args: cobra.NoArgs,
+	Run:  validate,
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+}
+
+func validate(cmd *cobra.Command, args []string) {
+	raw := viper.GetString("modifiers")
+
+	if raw == "" && cfgErr != nil {
+		cmd.PrintErrf("config: %v\n", cfgErr)
+		os.Exit(1)
+	}
+
+	// the transports are only checked, transport names are resolved against
+	// them while parsing
+	transports, err := proxy.BuildTransports()
+
+	if err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	defer transport.Stage(transports)()
+
+	if _, err := proxy.ParseErrorRules([]byte(viper.GetString("errors"))); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	if _, err := proxy.ParseTrustedProxies(viper.GetStringSlice("trustedProxies")); err != nil {
+		cmd.PrintErrln(err)
+		os.Exit(1)
+	}
+
+	if raw := viper.GetString("upstream"); raw != "" {
+		if _, err := upstream.Parse(raw); err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+	}
+
+	results, err := proxy.ParseModifiers([]byte(raw))
+
+	if merr, ok := err.(*martian.MultiError); ok {
+		for _, err := range merr.Errors() {
+			cmd.PrintErrln(err)
+		}
+
+		cmd.PrintErrf("%d invalid modifier(s)\n", len(merr.Errors()))
+		os.Exit(1)
+	}
+
+	if err != nil {
+		cmd.PrintErrf("modifiers: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "%d modifier(s) OK\n", len(results))
+}
@@ -0,0 +1,54 @@
+package fixture
+
+// Diff returns a line diff of want and got, removed lines are prefixed with
+// "- ", added lines with "+ " and common lines with "  ".
+func Diff(want, got []string) []string {
+	// lcs[i][j] is the length of the longest common subsequence of want[i:]
+	// and got[j:]
+	lcs := make([][]int, len(want)+1)
+
+	for i := range lcs {
+		lcs[i] = make([]int, len(got)+1)
+	}
+
+	for i := len(want) - 1; i >= 0; i-- {
+		for j := len(got) - 1; j >= 0; j-- {
+			switch {
+			case want[i] == got[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var lines []string
+	i, j := 0, 0
+
+	for i < len(want) && j < len(got) {
+		switch {
+		case want[i] == got[j]:
+			lines = append(lines, "  "+want[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, "- "+want[i])
+			i++
+		default:
+			lines = append(lines, "+ "+got[j])
+			j++
+		}
+	}
+
+	for ; i < len(want); i++ {
+		lines = append(lines, "- "+want[i])
+	}
+
+	for ; j < len(got); j++ {
+		lines = append(lines, "+ "+got[j])
+	}
+
+	return lines
+}
@@ -0,0 +1,175 @@
+// Package fixture runs declarative request/response fixtures through a
+// modifier stack in-process, without any real upstream.
+package fixture
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/google/martian/v3"
+	"github.com/imranismail/bff/body"
+	"github.com/imranismail/bff/roundtrip"
+	"sigs.k8s.io/yaml"
+)
+
+// Fixture describes an incoming request, the canned responses of every
+// upstream it reaches and the expected final response.
+type Fixture struct {
+	Name     string              `json:"name"`
+	Request  Request             `json:"request"`
+	Upstream map[string]Response `json:"upstream"`
+	Expect   Response            `json:"expect"`
+}
+
+// Request is the incoming request of a fixture.
+type Request struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+// Response is either a canned upstream response or an expectation, zero
+// values are not compared.
+type Response struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+// Load parses a YAML list of fixtures.
+func Load(raw []byte) ([]Fixture, error) {
+	var fixtures []Fixture
+
+	if err := yaml.Unmarshal(raw, &fixtures); err != nil {
+		return nil, err
+	}
+
+	for i, f := range fixtures {
+		if f.Request.URL == "" {
+			return nil, fmt.Errorf("fixtures[%d] %s: request.url is required", i, f.Name)
+		}
+	}
+
+	return fixtures, nil
+}
+
+// Run sends the fixture request through mod, answering the proxied request and
+// every body.JSONResource fetch from f.Upstream, and returns a description of
+// each mismatch with f.Expect. An empty result means the fixture passed.
+// Resource caches and circuit breakers are reset first, so fixtures do not
+// depend on the order they run in.
+func Run(f *Fixture, mod martian.RequestResponseModifier) ([]string, error) {
+	rt := RoundTripper(f.Upstream)
+
+	body.Reset()
+
+	body.SetRoundTripper(rt)
+	defer body.SetRoundTripper(nil)
+
+	req, err := f.Request.build()
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, remove, err := martian.TestContext(req, nil, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer remove()
+
+	res := roundtrip.Do(req, mod, rt)
+
+	return f.Expect.compare(res)
+}
+
+func (r *Request) build() (*http.Request, error) {
+	method := r.Method
+
+	if method == "" {
+		method = "GET"
+	}
+
+	req, err := http.NewRequest(method, r.URL, bytes.NewReader(r.Body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	// a path alone is an origin-form request, as a reverse proxy receives it
+	if strings.HasPrefix(r.URL, "/") {
+		req.RequestURI = r.URL
+	}
+
+	for key, val := range r.Headers {
+		req.Header.Set(key, val)
+	}
+
+	return req, nil
+}
+
+func (r *Response) compare(res *http.Response) ([]string, error) {
+	var failures []string
+
+	if r.Status != 0 && r.Status != res.StatusCode {
+		failures = append(failures, fmt.Sprintf("status: got %d, want %d", res.StatusCode, r.Status))
+	}
+
+	keys := make([]string, 0, len(r.Headers))
+
+	for key := range r.Headers {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if got := res.Header.Get(key); got != r.Headers[key] {
+			failures = append(failures, fmt.Sprintf("header %s: got %q, want %q", key, got, r.Headers[key]))
+		}
+	}
+
+	if len(r.Body) == 0 {
+		return failures, nil
+	}
+
+	got, err := ioutil.ReadAll(res.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	res.Body.Close()
+
+	var want, have interface{}
+
+	if err := json.Unmarshal(r.Body, &want); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(got, &have); err != nil {
+		failures = append(failures, fmt.Sprintf("body: not JSON: %q", got))
+		return failures, nil
+	}
+
+	if !reflect.DeepEqual(want, have) {
+		diff := Diff(pretty(want), pretty(have))
+		failures = append(failures, "body: (-want +got)\n"+strings.Join(diff, "\n"))
+	}
+
+	return failures, nil
+}
+
+func pretty(v interface{}) []string {
+	b, _ := json.MarshalIndent(v, "", "  ")
+	return strings.Split(string(b), "\n")
+}
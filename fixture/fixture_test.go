@@ -0,0 +1,48 @@
+package fixture
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/martian/v3/fifo"
+	"github.com/google/martian/v3/parse"
+	_ "github.com/imranismail/bff/body"
+)
+
+func TestRunResetsResourceCaches(t *testing.T) {
+	r, err := parse.FromJSON([]byte(`{
+		"body.JSONResource": {
+			"scope": ["response"],
+			"url": "http://resource.example.com/user",
+			"cache": {"ttl": "1m"}
+		}
+	}`))
+
+	if err != nil {
+		t.Fatalf("parse.FromJSON(): got %v, want no error", err)
+	}
+
+	stack := fifo.NewGroup()
+	stack.AddResponseModifier(r.ResponseModifier())
+
+	for _, name := range []string{"alice", "bob"} {
+		f := &Fixture{
+			Request: Request{URL: "http://example.com/"},
+			Upstream: map[string]Response{
+				"http://example.com/":              {Body: json.RawMessage(`{}`)},
+				"http://resource.example.com/user": {Body: json.RawMessage(`{"name":"` + name + `"}`)},
+			},
+			Expect: Response{Body: json.RawMessage(`{"name":"` + name + `"}`)},
+		}
+
+		failures, err := Run(f, stack)
+
+		if err != nil {
+			t.Fatalf("Run(%s): got %v, want no error", name, err)
+		}
+
+		if len(failures) > 0 {
+			t.Errorf("Run(%s): got failures %v, want none", name, failures)
+		}
+	}
+}
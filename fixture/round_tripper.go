@@ -0,0 +1,53 @@
+package fixture
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// RoundTripper answers requests with canned responses keyed by either
+// "METHOD URL" or URL, the former takes precedence.
+type RoundTripper map[string]Response
+
+// RoundTrip returns the canned response for req or an error if there is none.
+func (rt RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	canned, ok := rt[req.Method+" "+req.URL.String()]
+
+	if !ok {
+		canned, ok = rt[req.URL.String()]
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("fixture: no upstream response for %s %s", req.Method, req.URL)
+	}
+
+	status := canned.Status
+
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	res := &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          ioutil.NopCloser(bytes.NewReader(canned.Body)),
+		ContentLength: int64(len(canned.Body)),
+		Request:       req,
+	}
+
+	for key, val := range canned.Headers {
+		res.Header.Set(key, val)
+	}
+
+	if len(canned.Body) > 0 && res.Header.Get("Content-Type") == "" {
+		res.Header.Set("Content-Type", "application/json")
+	}
+
+	return res, nil
+}
@@ -3,6 +3,7 @@ package healthcheck
 import (
 	"encoding/json"
 	"net/http"
+	"sync/atomic"
 
 	"github.com/google/martian/v3"
 	"github.com/google/martian/v3/log"
@@ -19,10 +20,29 @@ type modifierJSON struct {
 	Scope      []parse.ModifierType `json:"scope"`
 }
 
+var draining int32
+
 func init() {
 	parse.Register("bff.Healthcheck", modifierFromJSON)
 }
 
+// SetDraining marks the process as draining, every healthcheck responds with
+// 503 until it is unset.
+func SetDraining(d bool) {
+	var v int32
+
+	if d {
+		v = 1
+	}
+
+	atomic.StoreInt32(&draining, v)
+}
+
+// Draining returns whether the process is draining connections.
+func Draining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
+
 func (m *Modifier) Match(req *http.Request) bool {
 	return req.URL.Path == "/healthz" && req.Method == "GET"
 }
@@ -41,7 +61,12 @@ func (m *Modifier) ModifyRequest(req *http.Request) error {
 func (m *Modifier) ModifyResponse(res *http.Response) error {
 	if m.Match(res.Request) {
 		log.Debugf("bff.Healthcheck.ModifyResponse: %s", res.Request.URL.String())
-		res.StatusCode = m.statusCode
+
+		if Draining() {
+			res.StatusCode = http.StatusServiceUnavailable
+		} else {
+			res.StatusCode = m.statusCode
+		}
 	}
 	return nil
 }
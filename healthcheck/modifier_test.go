@@ -0,0 +1,59 @@
+package healthcheck
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/martian/v3"
+	"github.com/google/martian/v3/proxyutil"
+)
+
+func TestModifierDraining(t *testing.T) {
+	defer SetDraining(false)
+
+	tt := []struct {
+		path     string
+		draining bool
+		want     int
+		skipped  bool
+	}{
+		{path: "/healthz", want: 200, skipped: true},
+		{path: "/healthz", draining: true, want: 503, skipped: true},
+		{path: "/users", want: 404},
+		{path: "/users", draining: true, want: 404},
+	}
+
+	mod := NewModifier(0)
+
+	for i, tc := range tt {
+		SetDraining(tc.draining)
+
+		req, err := http.NewRequest("GET", "http://example.com"+tc.path, nil)
+		if err != nil {
+			t.Fatalf("%d. http.NewRequest(): got %v, want no error", i, err)
+		}
+
+		ctx, remove, err := martian.TestContext(req, nil, nil)
+		if err != nil {
+			t.Fatalf("%d. martian.TestContext(): got %v, want no error", i, err)
+		}
+
+		if err := mod.ModifyRequest(req); err != nil {
+			t.Fatalf("%d. ModifyRequest(): got %v, want no error", i, err)
+		}
+		if got := ctx.SkippingRoundTrip(); got != tc.skipped {
+			t.Errorf("%d. ctx.SkippingRoundTrip(): got %t, want %t", i, got, tc.skipped)
+		}
+
+		res := proxyutil.NewResponse(404, nil, req)
+
+		if err := mod.ModifyResponse(res); err != nil {
+			t.Fatalf("%d. ModifyResponse(): got %v, want no error", i, err)
+		}
+		if got := res.StatusCode; got != tc.want {
+			t.Errorf("%d. res.StatusCode: got %d, want %d", i, got, tc.want)
+		}
+
+		remove()
+	}
+}
@@ -1,6 +1,7 @@
 package log
 
 import (
+	"fmt"
 	"io"
 	"os"
 
@@ -31,11 +32,11 @@ func (l *logger) Errorf(format string, args ...interface{}) {
 	l.Zlog.Error().Msgf(format, args...)
 }
 
-func (l *logger) Configure() {
-	level, err := zerolog.ParseLevel(viper.GetString("verbosity"))
+func (l *logger) Configure() error {
+	level, err := verbosity()
 
 	if err != nil {
-		l.Zlog.Fatal().Msgf("Failed to parse verbosity: %v", err)
+		return err
 	}
 
 	var output io.Writer
@@ -46,8 +47,23 @@ func (l *logger) Configure() {
 		output = os.Stderr
 	}
 
-	l.Zlog = l.Zlog.Level(level).Output(output)
+	// the level is global so that it can be changed while logging
+	l.Zlog = l.Zlog.Level(zerolog.TraceLevel).Output(output)
+	zerolog.SetGlobalLevel(level)
 	mlog.SetLogger(l)
+
+	return nil
+}
+
+// verbosity returns the configured log level.
+func verbosity() (zerolog.Level, error) {
+	level, err := zerolog.ParseLevel(viper.GetString("verbosity"))
+
+	if err != nil {
+		return level, fmt.Errorf("log: invalid verbosity: %v", err)
+	}
+
+	return level, nil
 }
 
 func Infof(format string, args ...interface{}) {
@@ -62,6 +78,33 @@ func Errorf(format string, args ...interface{}) {
 	Logger.Errorf(format, args...)
 }
 
-func Configure() {
-	Logger.Configure()
+// Configure applies the log settings of the config.
+func Configure() error {
+	return Logger.Configure()
+}
+
+// Validate returns an error when the log settings of the config are invalid,
+// without applying them.
+func Validate() error {
+	_, err := verbosity()
+
+	return err
+}
+
+// SetLevel changes the log level until the next Configure.
+func SetLevel(level string) error {
+	lvl, err := zerolog.ParseLevel(level)
+
+	if err != nil {
+		return err
+	}
+
+	zerolog.SetGlobalLevel(lvl)
+
+	return nil
+}
+
+// Level returns the current log level.
+func Level() string {
+	return zerolog.GlobalLevel().String()
 }
@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+
+	"github.com/imranismail/bff/config"
+	"github.com/imranismail/bff/log"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// modifierNames are the modifiers registered by the packages imported in
+// proxy.go, martian does not expose its parse registry so they are listed by
+// hand.
+var modifierNames = []string{
+	"bff.Healthcheck",
+	"bff.MethodModifier",
+	"bff.QuerystringModifier",
+	"bff.Routes",
+	"bff.URLFilter",
+	"bff.URLModifier",
+	"bff.URLVerifier",
+	"bff.Upstream",
+	"bfflog.Logger",
+	"body.JSONMapPatch",
+	"body.JSONPatch",
+	"body.JSONResource",
+	"body.JSONResponse",
+	"body.Modifier",
+	"body.MultiFetcher",
+	"cookie.Filter",
+	"cookie.Modifier",
+	"failure.Verifier",
+	"fifo.Group",
+	"header.Append",
+	"header.Blacklist",
+	"header.Copy",
+	"header.Filter",
+	"header.Id",
+	"header.Modifier",
+	"header.RegexFilter",
+	"header.Verifier",
+	"method.Filter",
+	"method.Verifier",
+	"pingback.Verifier",
+	"port.Filter",
+	"port.Modifier",
+	"priority.Group",
+	"querystring.Filter",
+	"querystring.Modifier",
+	"querystring.Verifier",
+	"skip.RoundTrip",
+	"stash.Modifier",
+	"static.Modifier",
+	"status.Filter",
+	"status.Modifier",
+	"status.Verifier",
+	"url.Filter",
+	"url.Modifier",
+	"url.RegexFilter",
+	"url.Verifier",
+}
+
+type versionResponse struct {
+	Version        string        `json:"version"`
+	Config         *LoadedConfig `json:"config"`
+	Reloads        uint64        `json:"reloads"`
+	ReloadFailures uint64        `json:"reloadFailures"`
+}
+
+type logLevel struct {
+	Level string `json:"level"`
+}
+
+type adminError struct {
+	Error string `json:"error"`
+}
+
+// newAdminServer returns the server of the admin endpoints, they are only
+// served on the admin port and never through the proxy.
+func newAdminServer() *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/config", allow(http.MethodGet, handleConfig))
+	mux.HandleFunc("/version", allow(http.MethodGet, handleVersion))
+	mux.HandleFunc("/reload", allow(http.MethodPost, handleReload))
+	mux.HandleFunc("/modifiers", allow(http.MethodGet, handleModifiers))
+	mux.HandleFunc("/loglevel", handleLogLevel)
+
+	return &http.Server{Handler: mux}
+}
+
+// listenAdmin listens on address and port, an empty address listens on all
+// interfaces.
+func listenAdmin(address, port string) (net.Listener, error) {
+	return net.Listen("tcp", net.JoinHostPort(address, port))
+}
+
+// serveAdmin serves the admin endpoints on address and port in the
+// background.
+func serveAdmin(address, port string) (*http.Server, error) {
+	listener, err := listenAdmin(address, port)
+
+	if err != nil {
+		return nil, err
+	}
+
+	server := newAdminServer()
+
+	log.Infof("bff: starting admin server on %s", listener.Addr().String())
+
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Errorf("bff: admin server: %v", err)
+		}
+	}()
+
+	return server, nil
+}
+
+func allow(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != method {
+			rw.Header().Set("Allow", method)
+			writeJSON(rw, http.StatusMethodNotAllowed, adminError{Error: "method not allowed"})
+			return
+		}
+
+		handler(rw, req)
+	}
+}
+
+func writeJSON(rw http.ResponseWriter, status int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+
+	enc := json.NewEncoder(rw)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// handleConfig responds with the modifiers config of the active stack.
+func handleConfig(rw http.ResponseWriter, req *http.Request) {
+	loaded := Modifiers.Loaded()
+
+	if loaded == nil {
+		writeJSON(rw, http.StatusServiceUnavailable, adminError{Error: "no config loaded"})
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, loaded.Modifiers)
+}
+
+// handleVersion responds with the bff version, the version and load time of
+// the active config and the reload counts.
+func handleVersion(rw http.ResponseWriter, req *http.Request) {
+	writeJSON(rw, http.StatusOK, versionResponse{
+		Version:        config.Version,
+		Config:         Modifiers.Loaded(),
+		Reloads:        Modifiers.Reloads(),
+		ReloadFailures: Modifiers.ReloadFailures(),
+	})
+}
+
+// handleReload reads the config file again and reloads the modifier stack.
+func handleReload(rw http.ResponseWriter, req *http.Request) {
+	log.Infof("bff: reload requested from the admin API")
+
+	if err := ReloadConfig(); err != nil {
+		log.Errorf("bff: reload: %v, keeping previous modifiers", err)
+		writeJSON(rw, http.StatusUnprocessableEntity, adminError{Error: err.Error()})
+
+		return
+	}
+
+	handleVersion(rw, req)
+}
+
+// handleModifiers responds with the names of the registered modifiers.
+func handleModifiers(rw http.ResponseWriter, req *http.Request) {
+	names := append([]string{}, modifierNames...)
+	sort.Strings(names)
+
+	writeJSON(rw, http.StatusOK, names)
+}
+
+// handleLogLevel responds with the log level on GET and changes it on PUT,
+// until the config is reloaded.
+func handleLogLevel(rw http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var body logLevel
+
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeJSON(rw, http.StatusBadRequest, adminError{Error: err.Error()})
+			return
+		}
+
+		if err := log.SetLevel(body.Level); err != nil {
+			writeJSON(rw, http.StatusBadRequest, adminError{Error: err.Error()})
+			return
+		}
+
+		log.Infof("bff: log level set to %s from the admin API", log.Level())
+	default:
+		rw.Header().Set("Allow", "GET, PUT")
+		writeJSON(rw, http.StatusMethodNotAllowed, adminError{Error: "method not allowed"})
+
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, logLevel{Level: log.Level()})
+}
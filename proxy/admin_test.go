@@ -0,0 +1,231 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/martian/v3/parse"
+	"github.com/imranismail/bff/log"
+	"github.com/imranismail/bff/transport"
+	"github.com/spf13/viper"
+)
+
+func TestListenAdmin(t *testing.T) {
+	tt := []struct {
+		address string
+		want    net.IP
+	}{
+		{address: "127.0.0.1", want: net.IPv4(127, 0, 0, 1)},
+	}
+
+	for i, tc := range tt {
+		listener, err := listenAdmin(tc.address, "0")
+		if err != nil {
+			t.Fatalf("%d. listenAdmin(%q): got %v, want no error", i, tc.address, err)
+		}
+
+		got := listener.Addr().(*net.TCPAddr).IP
+		listener.Close()
+
+		if !got.Equal(tc.want) {
+			t.Errorf("%d. listenAdmin(%q): got %s, want %s", i, tc.address, got, tc.want)
+		}
+	}
+}
+
+func TestModifierNamesAreRegistered(t *testing.T) {
+	for _, name := range modifierNames {
+		_, err := parse.FromJSON([]byte(`{"` + name + `": {}}`))
+
+		var unknown parse.ErrUnknownModifier
+		if errors.As(err, &unknown) {
+			t.Errorf("modifierNames: %s is not registered", name)
+		}
+	}
+}
+
+func TestModifierNamesListBffModifiers(t *testing.T) {
+	files, err := filepath.Glob("../*/*.go")
+	if err != nil {
+		t.Fatalf("filepath.Glob(): got %v, want no error", err)
+	}
+
+	listed := make(map[string]bool)
+
+	for _, name := range modifierNames {
+		listed[name] = true
+	}
+
+	registerRe := regexp.MustCompile(`parse\.Register\("([^"]+)"`)
+
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("ioutil.ReadFile(%s): got %v, want no error", file, err)
+		}
+
+		for _, match := range registerRe.FindAllSubmatch(src, -1) {
+			if name := string(match[1]); !listed[name] {
+				t.Errorf("modifierNames: %s registered in %s is not listed", name, file)
+			}
+		}
+	}
+}
+
+// serveAdminRequest sends a request to the admin endpoints.
+func serveAdminRequest(t *testing.T, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rw := httptest.NewRecorder()
+
+	newAdminServer().Handler.ServeHTTP(rw, req)
+
+	return rw
+}
+
+func TestAdminReload(t *testing.T) {
+	defer viper.Reset()
+	defer transport.Publish(&transport.Registry{})
+
+	file := filepath.Join(t.TempDir(), "config.yml")
+	viper.SetConfigFile(file)
+
+	if rw := serveAdminRequest(t, http.MethodGet, "/reload", ""); rw.Code != http.StatusMethodNotAllowed || rw.Header().Get("Allow") != http.MethodPost {
+		t.Errorf("GET /reload: got %d, Allow %q, want %d, Allow %q", rw.Code, rw.Header().Get("Allow"), http.StatusMethodNotAllowed, http.MethodPost)
+	}
+
+	tt := []struct {
+		config string
+		status int
+	}{
+		{config: "modifiers: '[]'\n", status: http.StatusOK},
+		{config: "modifiers: '[{\"unknown.Modifier\": {}}]'\n", status: http.StatusUnprocessableEntity},
+	}
+
+	for i, tc := range tt {
+		if err := ioutil.WriteFile(file, []byte(tc.config), 0644); err != nil {
+			t.Fatalf("%d. ioutil.WriteFile(): got %v, want no error", i, err)
+		}
+
+		failures := Modifiers.ReloadFailures()
+		rw := serveAdminRequest(t, http.MethodPost, "/reload", "")
+
+		if rw.Code != tc.status {
+			t.Fatalf("%d. POST /reload: got %d, want %d: %s", i, rw.Code, tc.status, rw.Body)
+		}
+
+		if tc.status != http.StatusOK {
+			var body adminError
+			if err := json.Unmarshal(rw.Body.Bytes(), &body); err != nil || body.Error == "" {
+				t.Errorf("%d. POST /reload: got body %s, want an error", i, rw.Body)
+			}
+			if got, want := Modifiers.ReloadFailures(), failures+1; got != want {
+				t.Errorf("%d. Modifiers.ReloadFailures(): got %d, want %d", i, got, want)
+			}
+
+			continue
+		}
+
+		var body versionResponse
+		if err := json.Unmarshal(rw.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%d. json.Unmarshal(): got %v, want no error", i, err)
+		}
+		if body.Config == nil || string(body.Config.Modifiers) != "[]" {
+			t.Errorf("%d. POST /reload: got config %+v, want the reloaded modifiers", i, body.Config)
+		}
+	}
+}
+
+func TestAdminLogLevel(t *testing.T) {
+	defer log.SetLevel(log.Level())
+
+	if err := log.SetLevel("info"); err != nil {
+		t.Fatalf("log.SetLevel(): got %v, want no error", err)
+	}
+
+	tt := []struct {
+		method string
+		body   string
+		status int
+		level  string
+	}{
+		{method: http.MethodGet, status: http.StatusOK, level: "info"},
+		{method: http.MethodPut, body: `{"level": "debug"}`, status: http.StatusOK, level: "debug"},
+		{method: http.MethodGet, status: http.StatusOK, level: "debug"},
+		{method: http.MethodPut, body: `{"level": "loud"}`, status: http.StatusBadRequest},
+		{method: http.MethodPut, body: `level`, status: http.StatusBadRequest},
+		{method: http.MethodPost, body: `{"level": "info"}`, status: http.StatusMethodNotAllowed},
+	}
+
+	for i, tc := range tt {
+		rw := serveAdminRequest(t, tc.method, "/loglevel", tc.body)
+
+		if rw.Code != tc.status {
+			t.Fatalf("%d. %s /loglevel: got %d, want %d: %s", i, tc.method, rw.Code, tc.status, rw.Body)
+		}
+
+		if tc.status != http.StatusOK {
+			continue
+		}
+
+		var body logLevel
+		if err := json.Unmarshal(rw.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%d. json.Unmarshal(): got %v, want no error", i, err)
+		}
+		if body.Level != tc.level {
+			t.Errorf("%d. %s /loglevel: got %q, want %q", i, tc.method, body.Level, tc.level)
+		}
+	}
+
+	if got, want := log.Level(), "debug"; got != want {
+		t.Errorf("log.Level(): got %s after rejected changes, want %s", got, want)
+	}
+}
+
+func TestAdminConfig(t *testing.T) {
+	defer viper.Reset()
+	defer transport.Publish(&transport.Registry{})
+
+	viper.Set("modifiers", `[{"header.Modifier": {"scope": ["request"], "name": "X-Test", "value": "1"}}]`)
+
+	if err := Modifiers.Reload(); err != nil {
+		t.Fatalf("Modifiers.Reload(): got %v, want no error", err)
+	}
+
+	if rw := serveAdminRequest(t, http.MethodPost, "/config", ""); rw.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /config: got %d, want %d", rw.Code, http.StatusMethodNotAllowed)
+	}
+
+	rw := serveAdminRequest(t, http.MethodGet, "/config", "")
+
+	if rw.Code != http.StatusOK {
+		t.Fatalf("GET /config: got %d, want %d: %s", rw.Code, http.StatusOK, rw.Body)
+	}
+
+	var got, want interface{}
+
+	if err := json.Unmarshal(rw.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal(): got %v, want no error", err)
+	}
+	if err := json.Unmarshal([]byte(viper.GetString("modifiers")), &want); err != nil {
+		t.Fatalf("json.Unmarshal(): got %v, want no error", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GET /config: got %v, want %v", got, want)
+	}
+}
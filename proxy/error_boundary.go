@@ -11,69 +11,95 @@ import (
 	"github.com/google/martian/v3/verify"
 )
 
-// ErrorBoundary WIP
-type ErrorBoundary struct {
-	reqmod martian.RequestModifier
-	resmod martian.ResponseModifier
-	reqv   verify.RequestVerifier
-	resv   verify.ResponseVerifier
-}
-
-type boundaryResponse struct {
-	Errors []boundaryError `json:"errors"`
-}
+const requestErrorsKey = "proxy.ErrorBoundary.RequestErrors"
 
-type boundaryError struct {
-	Message string `json:"message"`
+// ErrorBoundary wraps the modifier stack and turns the errors of the request
+// and response modifiers and verifiers into an RFC 7807 problem response.
+type ErrorBoundary struct {
+	reqmod      martian.RequestModifier
+	resmod      martian.ResponseModifier
+	reqv        verify.RequestVerifier
+	resv        verify.ResponseVerifier
+	hideDetails bool
+	rules       *ErrorRules
 }
 
-// NewErrorBoundary WIP
+// NewErrorBoundary returns an ErrorBoundary.
 func NewErrorBoundary() *ErrorBoundary {
 	return &ErrorBoundary{}
 }
 
-// SetRequestModifier WIP
+// SetRequestModifier sets the wrapped request modifier.
 func (eb *ErrorBoundary) SetRequestModifier(reqmod martian.RequestModifier) {
 	eb.reqmod = reqmod
 }
 
-// SetResponseModifier WIP
+// SetResponseModifier sets the wrapped response modifier.
 func (eb *ErrorBoundary) SetResponseModifier(resmod martian.ResponseModifier) {
 	eb.resmod = resmod
 }
 
-// SetRequestVerifier WIP
+// SetRequestVerifier sets the wrapped request verifier.
 func (eb *ErrorBoundary) SetRequestVerifier(reqv verify.RequestVerifier) {
 	eb.reqv = reqv
 }
 
-// SetResponseVerifier WIP
+// SetResponseVerifier sets the wrapped response verifier.
 func (eb *ErrorBoundary) SetResponseVerifier(resv verify.ResponseVerifier) {
 	eb.resv = resv
 }
 
-// ModifyRequest WIP
+// SetHideDetails leaves the error messages out of the problem responses.
+func (eb *ErrorBoundary) SetHideDetails(hide bool) {
+	eb.hideDetails = hide
+}
+
+// SetErrorRules sets the rules deciding the responses for the errors they
+// match.
+func (eb *ErrorBoundary) SetErrorRules(rules *ErrorRules) {
+	eb.rules = rules
+}
+
+// ModifyRequest runs the request modifier and verifier. When they fail the
+// round trip is skipped and their errors are reported in the response.
 func (eb *ErrorBoundary) ModifyRequest(req *http.Request) error {
 	defer eb.reqv.ResetRequestVerifications()
 
 	merr := martian.NewMultiError()
 
+	var errs []classifiedError
+
 	if err := eb.reqmod.ModifyRequest(req); err != nil {
 		merr.Add(err)
+		errs = append(errs, classify(err, ErrorInternal)...)
 	}
 
 	if err := eb.reqv.VerifyRequests(); err != nil {
 		merr.Add(err)
+		errs = append(errs, classify(err, ErrorInvalidRequest)...)
 	}
 
-	if !merr.Empty() {
+	if merr.Empty() {
+		return nil
+	}
+
+	ctx := martian.NewContext(req)
+
+	if ctx == nil {
 		return merr
 	}
 
+	// the failed request is not sent upstream, the error response is built
+	// from the recorded errors in ModifyResponse
+	ctx.Set(requestErrorsKey, errs)
+	ctx.SkipRoundTrip()
+
 	return nil
 }
 
-// ModifyResponse WIP
+// ModifyResponse runs the response modifier and verifier and replaces the
+// response with an error response if they, or the request modifier and
+// verifier, failed.
 func (eb *ErrorBoundary) ModifyResponse(res *http.Response) error {
 	defer eb.resv.ResetResponseVerifications()
 
@@ -89,50 +115,72 @@ func (eb *ErrorBoundary) ModifyResponse(res *http.Response) error {
 		return nil
 	}
 
-	merr := martian.NewMultiError()
+	upstreamStatus := res.StatusCode
 
-	if eb.resmod != nil {
-		if err := eb.resmod.ModifyResponse(res); err != nil {
-			merr.Add(err)
-		}
+	var errs []classifiedError
+
+	if reqErrs, ok := ctx.Get(requestErrorsKey); ok {
+		// there is no upstream response to modify
+		errs = reqErrs.([]classifiedError)
+		upstreamStatus = 0
+	} else {
+		errs = eb.modifyResponse(res)
 	}
 
-	if eb.resv != nil {
-		if err := eb.resv.VerifyResponses(); err != nil {
-			merr.Add(err)
-		}
+	if len(errs) == 0 {
+		return nil
+	}
+
+	for _, err := range errs {
+		log.Errorf("proxy.ErrorBoundary.ModifyResponse: %s: %v", err.class.Name, err.err)
+		boundaryErrors.WithLabelValues(err.class.Name).Inc()
 	}
 
-	if !merr.Empty() {
-		log.Errorf("proxy.ErrorBoundary.ModifyResponse: %v", merr)
+	problem := newProblem(errs, res.Request.URL.Path, eb.hideDetails)
 
-		res.Body.Close()
+	res.Header.Del("Content-Encoding")
+	res.Header.Set("Content-Type", problemContentType)
 
-		resp, err := merrToJSON(merr)
+	for key, values := range errorHeaders(errs) {
+		res.Header[key] = values
+	}
 
-		if err != nil {
-			return err
-		}
+	var resp []byte
+	var err error
 
-		res.ContentLength = int64(len(resp))
-		res.Body = ioutil.NopCloser(bytes.NewReader(resp))
-		res.StatusCode = http.StatusInternalServerError
-		res.Status = http.StatusText(res.StatusCode)
+	if rule, matched, ok := eb.rules.match(errs, upstreamStatus); ok {
+		resp, err = rule.apply(res, problem, matched)
+	} else {
+		resp, err = json.Marshal(problem)
 	}
 
+	if err != nil {
+		return err
+	}
+
+	res.Body.Close()
+	res.ContentLength = int64(len(resp))
+	res.Body = ioutil.NopCloser(bytes.NewReader(resp))
+	res.StatusCode = problem.Status
+	res.Status = http.StatusText(res.StatusCode)
+
 	return nil
 }
 
-func merrToJSON(merr *martian.MultiError) ([]byte, error) {
-	errs := merr.Errors()
+func (eb *ErrorBoundary) modifyResponse(res *http.Response) []classifiedError {
+	var errs []classifiedError
 
-	vres := &boundaryResponse{
-		Errors: make([]boundaryError, 0),
+	if eb.resmod != nil {
+		if err := eb.resmod.ModifyResponse(res); err != nil {
+			errs = append(errs, classify(err, ErrorInternal)...)
+		}
 	}
 
-	for _, err := range errs {
-		vres.Errors = append(vres.Errors, boundaryError{Message: err.Error()})
+	if eb.resv != nil {
+		if err := eb.resv.VerifyResponses(); err != nil {
+			errs = append(errs, classify(err, ErrorVerificationFailed)...)
+		}
 	}
 
-	return json.Marshal(vres)
+	return errs
 }
@@ -0,0 +1,127 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/google/martian/v3"
+	"github.com/google/martian/v3/martiantest"
+	"github.com/google/martian/v3/proxyutil"
+	"github.com/google/martian/v3/verify"
+)
+
+func TestErrorBoundaryRequestErrorsSkipRoundTrip(t *testing.T) {
+	tt := []struct {
+		modErr    error
+		verifyErr error
+		status    int
+		typ       string
+	}{
+		{modErr: errors.New("boom"), status: 500, typ: "urn:bff:problem:internal-error"},
+		{verifyErr: errors.New("missing header"), status: 400, typ: "urn:bff:problem:invalid-request"},
+	}
+
+	for i, tc := range tt {
+		tm := martiantest.NewModifier()
+		tm.RequestError(tc.modErr)
+		tv := &verify.TestVerifier{RequestError: tc.verifyErr}
+
+		eb := newTestBoundary(tm, tv)
+
+		req, err := http.NewRequest("GET", "http://example.com/users/1", nil)
+		if err != nil {
+			t.Fatalf("%d. http.NewRequest(): got %v, want no error", i, err)
+		}
+
+		ctx, remove, err := martian.TestContext(req, nil, nil)
+		if err != nil {
+			t.Fatalf("%d. martian.TestContext(): got %v, want no error", i, err)
+		}
+
+		if err := eb.ModifyRequest(req); err != nil {
+			t.Fatalf("%d. ModifyRequest(): got %v, want no error", i, err)
+		}
+		if !ctx.SkippingRoundTrip() {
+			t.Errorf("%d. ctx.SkippingRoundTrip(): got false, want true", i)
+		}
+
+		// martian answers a skipped round trip with an empty 200
+		res := proxyutil.NewResponse(200, nil, req)
+
+		if err := eb.ModifyResponse(res); err != nil {
+			t.Fatalf("%d. ModifyResponse(): got %v, want no error", i, err)
+		}
+		if tm.ResponseModified() {
+			t.Errorf("%d. tm.ResponseModified(): got true, want the response modifiers skipped", i)
+		}
+		if got := res.StatusCode; got != tc.status {
+			t.Errorf("%d. res.StatusCode: got %d, want %d", i, got, tc.status)
+		}
+
+		b, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatalf("%d. ioutil.ReadAll(): got %v, want no error", i, err)
+		}
+
+		problem := &Problem{}
+		if err := json.Unmarshal(b, problem); err != nil {
+			t.Fatalf("%d. json.Unmarshal(%s): got %v, want no error", i, b, err)
+		}
+		if problem.Type != tc.typ {
+			t.Errorf("%d. problem.Type: got %s, want %s", i, problem.Type, tc.typ)
+		}
+
+		remove()
+	}
+}
+
+func TestErrorBoundaryRequestWithoutContext(t *testing.T) {
+	tm := martiantest.NewModifier()
+	tm.RequestError(errors.New("boom"))
+
+	eb := newTestBoundary(tm, &verify.TestVerifier{})
+
+	req, err := http.NewRequest("GET", "http://example.com/users/1", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest(): got %v, want no error", err)
+	}
+
+	if err := eb.ModifyRequest(req); err == nil {
+		t.Error("ModifyRequest(): got no error without a context, want error")
+	}
+}
+
+func TestErrorBoundaryUpstreamResponse(t *testing.T) {
+	tm := martiantest.NewModifier()
+	eb := newTestBoundary(tm, &verify.TestVerifier{})
+
+	req, err := http.NewRequest("GET", "http://example.com/users/1", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest(): got %v, want no error", err)
+	}
+
+	ctx, remove, err := martian.TestContext(req, nil, nil)
+	if err != nil {
+		t.Fatalf("martian.TestContext(): got %v, want no error", err)
+	}
+	defer remove()
+
+	if err := eb.ModifyRequest(req); err != nil {
+		t.Fatalf("ModifyRequest(): got %v, want no error", err)
+	}
+	if ctx.SkippingRoundTrip() {
+		t.Error("ctx.SkippingRoundTrip(): got true, want false")
+	}
+
+	res := proxyutil.NewResponse(200, nil, req)
+
+	if err := eb.ModifyResponse(res); err != nil {
+		t.Fatalf("ModifyResponse(): got %v, want no error", err)
+	}
+	if !tm.ResponseModified() {
+		t.Error("tm.ResponseModified(): got false, want true")
+	}
+}
@@ -0,0 +1,229 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"sigs.k8s.io/yaml"
+)
+
+// template variables have the form {name}, a string consisting of a single
+// variable is replaced by its JSON value
+var errorVariableRe = regexp.MustCompile(`"\{(?:type|title|status|detail|instance|modifier)\}"|\{(?:type|title|status|detail|instance|modifier)\}`)
+
+type errorRulesJSON struct {
+	Rules    []errorRuleJSON `json:"rules"`
+	Fallback *errorRuleJSON  `json:"fallback"`
+}
+
+type errorRuleJSON struct {
+	Match   *errorMatchJSON   `json:"match"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+type errorMatchJSON struct {
+	Modifier       string `json:"modifier"`
+	Message        string `json:"message"`
+	UpstreamStatus int    `json:"upstreamStatus"`
+}
+
+func (m *errorMatchJSON) empty() bool {
+	return m.Modifier == "" && m.Message == "" && m.UpstreamStatus == 0
+}
+
+// ErrorRules decide the response of the ErrorBoundary for the errors they
+// match, the first matching rule wins and the fallback rule matches anything.
+type ErrorRules struct {
+	rules    []*ErrorRule
+	fallback *ErrorRule
+}
+
+// ErrorRule matches errors by the name of the failing modifier, a regexp of the
+// error message and the status of the upstream response. Unset conditions
+// match anything.
+type ErrorRule struct {
+	modifier       string
+	message        *regexp.Regexp
+	upstreamStatus int
+	status         int
+	headers        map[string]string
+	body           []byte
+}
+
+// ParseErrorRules parses the YAML errors config, an empty config has no rules.
+func ParseErrorRules(raw []byte) (*ErrorRules, error) {
+	msg := &errorRulesJSON{}
+
+	if err := yaml.Unmarshal(raw, msg); err != nil {
+		return nil, fmt.Errorf("errors: %v", err)
+	}
+
+	rules := &ErrorRules{}
+
+	for i, r := range msg.Rules {
+		if r.Match == nil || r.Match.empty() {
+			return nil, fmt.Errorf("errors: rules[%d]: missing match, use the fallback rule to match anything", i)
+		}
+
+		rule, err := newErrorRule(r)
+
+		if err != nil {
+			return nil, fmt.Errorf("errors: rules[%d]: %v", i, err)
+		}
+
+		rules.rules = append(rules.rules, rule)
+	}
+
+	if msg.Fallback != nil {
+		if msg.Fallback.Match != nil {
+			return nil, errors.New("errors: fallback: the fallback rule can't have a match")
+		}
+
+		rule, err := newErrorRule(*msg.Fallback)
+
+		if err != nil {
+			return nil, fmt.Errorf("errors: fallback: %v", err)
+		}
+
+		rules.fallback = rule
+	}
+
+	return rules, nil
+}
+
+func newErrorRule(msg errorRuleJSON) (*ErrorRule, error) {
+	if msg.Status != 0 && (msg.Status < 100 || msg.Status > 599) {
+		return nil, fmt.Errorf("invalid status %d", msg.Status)
+	}
+
+	rule := &ErrorRule{
+		status:  msg.Status,
+		headers: msg.Headers,
+		body:    msg.Body,
+	}
+
+	if m := msg.Match; m != nil {
+		rule.modifier = m.Modifier
+		rule.upstreamStatus = m.UpstreamStatus
+
+		if m.Message != "" {
+			re, err := regexp.Compile(m.Message)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid message regexp: %v", err)
+			}
+
+			rule.message = re
+		}
+	}
+
+	if rule.body != nil && !json.Valid(rule.body) {
+		return nil, errors.New("invalid body")
+	}
+
+	return rule, nil
+}
+
+// match returns the first rule matching any of errs along with the matched
+// error.
+func (r *ErrorRules) match(errs []classifiedError, upstreamStatus int) (*ErrorRule, classifiedError, bool) {
+	if r == nil {
+		return nil, classifiedError{}, false
+	}
+
+	for _, rule := range r.rules {
+		for _, err := range errs {
+			if rule.matches(err, upstreamStatus) {
+				return rule, err, true
+			}
+		}
+	}
+
+	if r.fallback != nil {
+		return r.fallback, errs[0], true
+	}
+
+	return nil, classifiedError{}, false
+}
+
+func (rule *ErrorRule) matches(err classifiedError, upstreamStatus int) bool {
+	// the innermost modifier or any entry it is nested in
+	if rule.modifier != "" && (err.failure == nil || !err.failure.Within(rule.modifier)) {
+		return false
+	}
+
+	if rule.message != nil && !rule.message.MatchString(err.err.Error()) {
+		return false
+	}
+
+	if rule.upstreamStatus != 0 && rule.upstreamStatus != upstreamStatus {
+		return false
+	}
+
+	return true
+}
+
+// apply overrides the problem response with the status, headers and body of
+// the rule, the body template is filled in with the matched error.
+func (rule *ErrorRule) apply(res *http.Response, problem *Problem, matched classifiedError) ([]byte, error) {
+	if rule.status != 0 {
+		problem.Status = rule.status
+	}
+
+	resp, err := json.Marshal(problem)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if rule.body != nil {
+		resp = rule.render(problem, matched)
+		res.Header.Set("Content-Type", "application/json")
+	}
+
+	for key, value := range rule.headers {
+		res.Header.Set(key, value)
+	}
+
+	return resp, nil
+}
+
+// render fills in the body template with the variables of the matched error.
+func (rule *ErrorRule) render(problem *Problem, err classifiedError) []byte {
+	vars := map[string]interface{}{
+		"type":     err.class.Type(),
+		"title":    err.class.Title,
+		"status":   problem.Status,
+		"detail":   "",
+		"instance": problem.Instance,
+		"modifier": err.modifier,
+	}
+
+	// details are left out of the problem when they are hidden
+	if problem.Detail != "" {
+		vars["detail"] = err.err.Error()
+	}
+
+	return errorVariableRe.ReplaceAllFunc(rule.body, func(v []byte) []byte {
+		if v[0] == '"' {
+			raw, _ := json.Marshal(vars[string(v[2:len(v)-2])])
+			return raw
+		}
+
+		value := vars[string(v[1:len(v)-1])]
+
+		if status, ok := value.(int); ok {
+			return []byte(strconv.Itoa(status))
+		}
+
+		raw, _ := json.Marshal(value)
+
+		return raw[1 : len(raw)-1]
+	})
+}
@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/martian/v3"
+	"github.com/google/martian/v3/proxyutil"
+	"github.com/spf13/viper"
+)
+
+func TestParseErrorRulesMatch(t *testing.T) {
+	tt := []struct {
+		raw     string
+		wantErr bool
+	}{
+		{raw: `rules: [{match: {modifier: bff.URLVerifier}, status: 404}]`},
+		{raw: `rules: [{match: {upstreamStatus: 401}, status: 401}]`},
+		{raw: `fallback: {status: 500}`},
+		{raw: `rules: [{status: 404}]`, wantErr: true},
+		{raw: `rules: [{match: {}, status: 404}]`, wantErr: true},
+		{raw: `rules: [{match: {message: "("}}]`, wantErr: true},
+		{raw: `fallback: {match: {modifier: bff.URLVerifier}}`, wantErr: true},
+	}
+
+	for i, tc := range tt {
+		_, err := ParseErrorRules([]byte(tc.raw))
+
+		if got := err != nil; got != tc.wantErr {
+			t.Errorf("%d. ParseErrorRules(%q): got error %v, want error %t", i, tc.raw, err, tc.wantErr)
+		}
+	}
+}
+
+func TestErrorRulesMatchNestedModifier(t *testing.T) {
+	tt := []struct {
+		modifier string
+		want     int
+	}{
+		{modifier: "bff.URLVerifier", want: 404},
+		{modifier: "bff.URLFilter", want: 404},
+		{modifier: "header.Modifier", want: 400},
+	}
+
+	for i, tc := range tt {
+		viper.Set("modifiers", `[{"bff.URLFilter": {
+			"scope": ["request"],
+			"path": "/users/:id",
+			"modifier": {"bff.URLVerifier": {"scope": ["request"], "path": "/accounts/:id"}}
+		}}]`)
+		viper.Set("errors", `rules: [{match: {modifier: `+tc.modifier+`}, status: 404}]`)
+
+		eb, err := NewBoundary()
+		if err != nil {
+			t.Fatalf("%d. NewBoundary(): got %v, want no error", i, err)
+		}
+
+		req, err := http.NewRequest("GET", "http://example.com/users/1", nil)
+		if err != nil {
+			t.Fatalf("%d. http.NewRequest(): got %v, want no error", i, err)
+		}
+
+		_, remove, err := martian.TestContext(req, nil, nil)
+		if err != nil {
+			t.Fatalf("%d. martian.TestContext(): got %v, want no error", i, err)
+		}
+
+		if err := eb.ModifyRequest(req); err != nil {
+			t.Fatalf("%d. ModifyRequest(): got %v, want no error", i, err)
+		}
+
+		res := proxyutil.NewResponse(200, nil, req)
+		if err := eb.ModifyResponse(res); err != nil {
+			t.Fatalf("%d. ModifyResponse(): got %v, want no error", i, err)
+		}
+		if got := res.StatusCode; got != tc.want {
+			t.Errorf("%d. match.modifier %s: res.StatusCode: got %d, want %d", i, tc.modifier, got, tc.want)
+		}
+
+		remove()
+	}
+
+	viper.Reset()
+}
@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/google/martian/v3/fifo"
+	"github.com/google/martian/v3/header"
+)
+
+var forwardedHeaders = []string{"X-Forwarded-For", "X-Forwarded-Proto", "X-Forwarded-Host", "X-Forwarded-Url"}
+
+// forwardedModifier sets the X-Forwarded-For, X-Forwarded-Proto,
+// X-Forwarded-Host and X-Forwarded-Url headers. The headers sent by a trusted
+// proxy are kept, the client address being appended to X-Forwarded-For, the
+// ones sent by any other client are replaced so they cannot be spoofed.
+type forwardedModifier struct {
+	trusted []*net.IPNet
+}
+
+// ParseTrustedProxies parses a list of IP addresses and CIDR ranges.
+func ParseTrustedProxies(entries []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+
+			if ip == nil {
+				return nil, fmt.Errorf("trustedProxies: invalid address %q", entry)
+			}
+
+			bits := 8 * net.IPv6len
+
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+
+			continue
+		}
+
+		_, ipnet, err := net.ParseCIDR(entry)
+
+		if err != nil {
+			return nil, fmt.Errorf("trustedProxies: %v", err)
+		}
+
+		nets = append(nets, ipnet)
+	}
+
+	return nets, nil
+}
+
+func (m *forwardedModifier) isTrusted(addr string) bool {
+	ip := net.ParseIP(addr)
+
+	if ip == nil {
+		return false
+	}
+
+	for _, ipnet := range m.trusted {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *forwardedModifier) ModifyRequest(req *http.Request) error {
+	client, _, err := net.SplitHostPort(req.RemoteAddr)
+
+	if err != nil {
+		client = req.RemoteAddr
+	}
+
+	if !m.isTrusted(client) {
+		for _, name := range forwardedHeaders {
+			req.Header.Del(name)
+		}
+	}
+
+	if req.Header.Get("X-Forwarded-Proto") == "" {
+		req.Header.Set("X-Forwarded-Proto", req.URL.Scheme)
+	}
+
+	if req.Header.Get("X-Forwarded-Host") == "" {
+		req.Header.Set("X-Forwarded-Host", req.Host)
+	}
+
+	if req.Header.Get("X-Forwarded-Url") == "" {
+		req.Header.Set("X-Forwarded-Url", req.URL.String())
+	}
+
+	if client == "" {
+		return nil
+	}
+
+	if xff := req.Header.Get("X-Forwarded-For"); xff != "" {
+		client = xff + ", " + client
+	}
+
+	req.Header.Set("X-Forwarded-For", client)
+
+	return nil
+}
+
+// newHTTPStack is httpspec.NewStack with forwarded as the X-Forwarded-*
+// modifier.
+func newHTTPStack(via string, forwarded *forwardedModifier) (outer *fifo.Group, inner *fifo.Group) {
+	outer = fifo.NewGroup()
+
+	hbhm := header.NewHopByHopModifier()
+	outer.AddRequestModifier(hbhm)
+	outer.AddRequestModifier(forwarded)
+	outer.AddRequestModifier(header.NewBadFramingModifier())
+
+	vm := header.NewViaModifier(via)
+	outer.AddRequestModifier(vm)
+
+	inner = fifo.NewGroup()
+	outer.AddRequestModifier(inner)
+	outer.AddResponseModifier(inner)
+
+	outer.AddResponseModifier(vm)
+	outer.AddResponseModifier(hbhm)
+
+	return outer, inner
+}
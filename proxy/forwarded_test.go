@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	nets, err := ParseTrustedProxies([]string{"10.0.0.1", "192.168.0.0/16", "::1", "fd00::/8"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies(): got %v, want no error", err)
+	}
+
+	m := &forwardedModifier{trusted: nets}
+
+	tt := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "10.0.0.1", want: true},
+		{addr: "10.0.0.2", want: false},
+		{addr: "192.168.4.2", want: true},
+		{addr: "::1", want: true},
+		{addr: "fd12::1", want: true},
+		{addr: "2001:db8::1", want: false},
+		{addr: "not an ip", want: false},
+	}
+
+	for i, tc := range tt {
+		if got := m.isTrusted(tc.addr); got != tc.want {
+			t.Errorf("%d. isTrusted(%s): got %t, want %t", i, tc.addr, got, tc.want)
+		}
+	}
+
+	for i, entry := range []string{"10.0.0", "10.0.0.0/33", "example.com"} {
+		if _, err := ParseTrustedProxies([]string{entry}); err == nil {
+			t.Errorf("%d. ParseTrustedProxies(%q): got no error, want error", i, entry)
+		}
+	}
+}
+
+func TestForwardedModifier(t *testing.T) {
+	nets, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies(): got %v, want no error", err)
+	}
+
+	m := &forwardedModifier{trusted: nets}
+
+	tt := []struct {
+		remoteAddr string
+		want       map[string]string
+	}{
+		{
+			// a trusted proxy keeps the headers it sent
+			remoteAddr: "10.1.2.3:5000",
+			want: map[string]string{
+				"X-Forwarded-For":   "203.0.113.7, 10.1.2.3",
+				"X-Forwarded-Proto": "https",
+				"X-Forwarded-Host":  "public.example.com",
+				"X-Forwarded-Url":   "https://public.example.com/users/1",
+			},
+		},
+		{
+			// any other client can't spoof them
+			remoteAddr: "198.51.100.9:5000",
+			want: map[string]string{
+				"X-Forwarded-For":   "198.51.100.9",
+				"X-Forwarded-Proto": "http",
+				"X-Forwarded-Host":  "bff.local",
+				"X-Forwarded-Url":   "http://bff.local/users/1",
+			},
+		},
+	}
+
+	for i, tc := range tt {
+		req, err := http.NewRequest("GET", "http://bff.local/users/1", nil)
+		if err != nil {
+			t.Fatalf("%d. http.NewRequest(): got %v, want no error", i, err)
+		}
+		req.RemoteAddr = tc.remoteAddr
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+		req.Header.Set("X-Forwarded-Proto", "https")
+		req.Header.Set("X-Forwarded-Host", "public.example.com")
+		req.Header.Set("X-Forwarded-Url", "https://public.example.com/users/1")
+
+		if err := m.ModifyRequest(req); err != nil {
+			t.Fatalf("%d. ModifyRequest(): got %v, want no error", i, err)
+		}
+
+		for name, want := range tc.want {
+			if got := req.Header.Get(name); got != want {
+				t.Errorf("%d. %s: req.Header.Get(%q): got %q, want %q", i, tc.remoteAddr, name, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/martian/v3"
+	"github.com/imranismail/bff/log"
+	"github.com/imranismail/bff/roundtrip"
+	"golang.org/x/net/http2"
+)
+
+const handshakeTimeout = 10 * time.Second
+
+// tlsListener terminates TLS on the accepted connections. Connections
+// negotiating HTTP/1 are handed to martian through Accept, the ones
+// negotiating h2 are served by an http2.Server running the same modifiers
+// since martian only speaks HTTP/1.
+type tlsListener struct {
+	net.Listener
+
+	config *tls.Config
+	proxy  *martian.Proxy
+	stack  *Stack
+	h2     *http2.Server
+	// h2base is the base config of the h2 connections, shutting it down sends
+	// them a GOAWAY
+	h2base *http.Server
+
+	conns    chan net.Conn
+	errc     chan error
+	mu       sync.Mutex
+	draining bool
+	inflight sync.WaitGroup
+}
+
+func newTLSListener(listener net.Listener, config *tls.Config, proxy *martian.Proxy, stack *Stack) *tlsListener {
+	l := &tlsListener{
+		Listener: listener,
+		config:   config,
+		proxy:    proxy,
+		stack:    stack,
+		h2:       &http2.Server{},
+		conns:    make(chan net.Conn),
+		errc:     make(chan error, 1),
+	}
+
+	l.h2base = &http.Server{Handler: l}
+	http2.ConfigureServer(l.h2base, l.h2)
+
+	go l.run()
+
+	return l
+}
+
+// Accept returns the next HTTP/1 connection, its handshake is done.
+func (l *tlsListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errc:
+		return nil, err
+	}
+}
+
+func (l *tlsListener) run() {
+	for {
+		conn, err := l.Listener.Accept()
+
+		if err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Temporary() {
+				time.Sleep(5 * time.Millisecond)
+				continue
+			}
+
+			l.errc <- err
+
+			return
+		}
+
+		go l.handshake(conn)
+	}
+}
+
+// handshake does the TLS handshake of conn off the accept loop so that a slow
+// client does not hold up the others.
+func (l *tlsListener) handshake(conn net.Conn) {
+	tconn := tls.Server(conn, l.config)
+	tconn.SetDeadline(time.Now().Add(handshakeTimeout))
+
+	if err := tconn.Handshake(); err != nil {
+		log.Debugf("bff: TLS handshake with %s: %v", conn.RemoteAddr(), err)
+		conn.Close()
+
+		return
+	}
+
+	tconn.SetDeadline(time.Time{})
+
+	if tconn.ConnectionState().NegotiatedProtocol == http2.NextProtoTLS {
+		l.h2.ServeConn(tconn, &http2.ServeConnOpts{BaseConfig: l.h2base, Handler: l})
+		return
+	}
+
+	select {
+	case l.conns <- tconn:
+	case <-time.After(handshakeTimeout):
+		// martian stopped accepting
+		tconn.Close()
+	}
+}
+
+// Drain sends a GOAWAY to the h2 connections, refuses the streams opened
+// after it and waits for the in-flight ones to finish.
+func (l *tlsListener) Drain() {
+	l.mu.Lock()
+	l.draining = true
+	l.mu.Unlock()
+
+	// returns once the GOAWAYs are sent, there are no listeners to close
+	l.h2base.Shutdown(context.Background())
+	l.inflight.Wait()
+}
+
+// begin counts an h2 request in flight unless the listener is draining.
+func (l *tlsListener) begin() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.draining {
+		return false
+	}
+
+	l.inflight.Add(1)
+
+	return true
+}
+
+// ServeHTTP runs an h2 request through the modifier stack and upstream, the
+// way martian handles an HTTP/1 request.
+func (l *tlsListener) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if !l.begin() {
+		rw.Header().Set("Connection", "close")
+		http.Error(rw, "draining", http.StatusServiceUnavailable)
+
+		return
+	}
+
+	defer l.inflight.Done()
+
+	if req.Method == http.MethodConnect {
+		http.Error(rw, "CONNECT is not supported over h2", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// martian links contexts to requests it reads itself, TestContext is the
+	// only exported way to link one to a request read elsewhere
+	ctx, unlink, err := martian.TestContext(req, nil, nil)
+
+	if err != nil {
+		log.Errorf("bff: failed to build context: %v", err)
+		http.Error(rw, "internal error", http.StatusInternalServerError)
+
+		return
+	}
+
+	defer unlink()
+
+	ctx.Session().MarkSecure()
+
+	req.URL.Scheme = "https"
+
+	if req.URL.Host == "" {
+		req.URL.Host = req.Host
+	}
+
+	res := roundtrip.Do(req, l.stack, l.proxy.GetRoundTripper())
+	defer res.Body.Close()
+
+	for key, values := range res.Header {
+		rw.Header()[key] = values
+	}
+
+	rw.WriteHeader(res.StatusCode)
+
+	if _, err := io.Copy(rw, res.Body); err != nil {
+		log.Errorf("bff: writing response: %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/martian/v3"
+	"github.com/google/martian/v3/proxyutil"
+	"github.com/imranismail/bff/transport"
+	"github.com/spf13/viper"
+	"golang.org/x/net/http2"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// newTestTLSListener returns a tlsListener serving a stack that sets X-Stack
+// on responses, upstream requests are sent through rt.
+func newTestTLSListener(t *testing.T, rt http.RoundTripper) *tlsListener {
+	t.Helper()
+
+	t.Cleanup(viper.Reset)
+	t.Cleanup(func() { transport.Publish(&transport.Registry{}) })
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+
+	writeTestCert(t, certFile, keyFile, "localhost")
+
+	viper.Set("tls.certFile", certFile)
+	viper.Set("tls.keyFile", keyFile)
+	viper.Set("modifiers", `[{"header.Modifier": {"scope": ["response"], "name": "X-Stack", "value": "true"}}]`)
+
+	certs, err := newCertReloader()
+	if err != nil {
+		t.Fatalf("newCertReloader(): got %v, want no error", err)
+	}
+
+	stack := NewStack()
+	if err := stack.Reload(); err != nil {
+		t.Fatalf("stack.Reload(): got %v, want no error", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen(): got %v, want no error", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	p := martian.NewProxy()
+	p.SetRoundTripper(rt)
+
+	return newTLSListener(ln, certs.TLSConfig(), p, stack)
+}
+
+func newH2Client() *http.Client {
+	return &http.Client{
+		Transport: &http2.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+}
+
+func TestTLSListenerH2RoundTrip(t *testing.T) {
+	l := newTestTLSListener(t, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		res := proxyutil.NewResponse(200, nil, req)
+		res.Header.Set("X-Upstream-Path", req.URL.Path)
+
+		return res, nil
+	}))
+
+	res, err := newH2Client().Get("https://" + l.Addr().String() + "/users/42")
+	if err != nil {
+		t.Fatalf("Get(): got %v, want no error", err)
+	}
+	defer res.Body.Close()
+
+	if got, want := res.ProtoMajor, 2; got != want {
+		t.Errorf("res.ProtoMajor: got %d, want %d", got, want)
+	}
+	if got, want := res.StatusCode, 200; got != want {
+		t.Errorf("res.StatusCode: got %d, want %d", got, want)
+	}
+	if got, want := res.Header.Get("X-Upstream-Path"), "/users/42"; got != want {
+		t.Errorf("res.Header.Get(X-Upstream-Path): got %q, want %q", got, want)
+	}
+	if got, want := res.Header.Get("X-Stack"), "true"; got != want {
+		t.Errorf("res.Header.Get(X-Stack): got %q, want %q", got, want)
+	}
+}
+
+func TestTLSListenerDrainWaitsForInflightStreams(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	l := newTestTLSListener(t, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		close(started)
+		<-release
+
+		return proxyutil.NewResponse(200, nil, req), nil
+	}))
+
+	type result struct {
+		status int
+		err    error
+	}
+
+	done := make(chan result, 1)
+
+	go func() {
+		res, err := newH2Client().Get("https://" + l.Addr().String() + "/slow")
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		defer res.Body.Close()
+
+		ioutil.ReadAll(res.Body)
+		done <- result{status: res.StatusCode}
+	}()
+
+	<-started
+
+	drained := make(chan struct{})
+
+	go func() {
+		l.Drain()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		t.Fatal("Drain(): returned with a stream in flight, want it to wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+
+	select {
+	case <-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Drain(): did not return once the stream finished")
+	}
+
+	if r := <-done; r.err != nil || r.status != 200 {
+		t.Errorf("in-flight request: got %d, %v, want 200, no error", r.status, r.err)
+	}
+
+	if l.begin() {
+		t.Error("begin(): got true after Drain, want false")
+	}
+}
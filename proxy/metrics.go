@@ -0,0 +1,25 @@
+package proxy
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bff_requests_total",
+		Help: "Number of requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "bff_request_duration_seconds",
+		Help: "Duration of the requests by route and method.",
+	}, []string{"route", "method"})
+	boundaryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bff_errors_total",
+		Help: "Number of errors caught by the ErrorBoundary by class.",
+	}, []string{"class"})
+	configReloads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bff_config_reloads_total",
+		Help: "Number of config reloads by result.",
+	}, []string{"result"})
+)
@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/martian/v3"
+	"github.com/google/martian/v3/proxyutil"
+	"github.com/imranismail/bff/transport"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/viper"
+)
+
+func TestRequestsTotalRouteLabels(t *testing.T) {
+	defer viper.Reset()
+	defer transport.Publish(&transport.Registry{})
+
+	viper.Set("modifiers", `[{"bff.Routes": {"scope": ["request", "response"], "routes": [{"methods": ["GET"], "path": "/metrics-test/users/:id"}]}}]`)
+
+	s := NewStack()
+	if err := s.Reload(); err != nil {
+		t.Fatalf("s.Reload(): got %v, want no error", err)
+	}
+
+	tt := []struct {
+		url   string
+		route string
+	}{
+		{url: "http://example.com/metrics-test/users/42", route: "/metrics-test/users/:id"},
+		{url: "http://example.com/metrics-test/users/7", route: "/metrics-test/users/:id"},
+		{url: "http://example.com/metrics-test/posts/1", route: "unmatched"},
+	}
+
+	before := make(map[string]float64)
+
+	for _, tc := range tt {
+		before[tc.route] = testutil.ToFloat64(requestsTotal.WithLabelValues(tc.route, "GET", "200"))
+	}
+
+	for i, tc := range tt {
+		req, err := http.NewRequest("GET", tc.url, nil)
+		if err != nil {
+			t.Fatalf("%d. http.NewRequest(): got %v, want no error", i, err)
+		}
+
+		_, remove, err := martian.TestContext(req, nil, nil)
+		if err != nil {
+			t.Fatalf("%d. martian.TestContext(): got %v, want no error", i, err)
+		}
+
+		if err := s.ModifyRequest(req); err != nil {
+			t.Fatalf("%d. ModifyRequest(): got %v, want no error", i, err)
+		}
+
+		if err := s.ModifyResponse(proxyutil.NewResponse(200, nil, req)); err != nil {
+			t.Fatalf("%d. ModifyResponse(): got %v, want no error", i, err)
+		}
+
+		remove()
+	}
+
+	want := map[string]float64{"/metrics-test/users/:id": 2, "unmatched": 1}
+
+	for route, n := range want {
+		if got := testutil.ToFloat64(requestsTotal.WithLabelValues(route, "GET", "200")) - before[route]; got != n {
+			t.Errorf("bff_requests_total{route=%q}: got %v more, want %v", route, got, n)
+		}
+	}
+}
+
+func TestConfigReloadsTotal(t *testing.T) {
+	defer viper.Reset()
+	defer transport.Publish(&transport.Registry{})
+
+	success := testutil.ToFloat64(configReloads.WithLabelValues("success"))
+	failure := testutil.ToFloat64(configReloads.WithLabelValues("failure"))
+
+	s := NewStack()
+
+	for _, modifiers := range []string{`[]`, `[{"unknown.Modifier": {}}]`, `[]`} {
+		viper.Set("modifiers", modifiers)
+		s.Reload()
+	}
+
+	if got := testutil.ToFloat64(configReloads.WithLabelValues("success")) - success; got != 2 {
+		t.Errorf(`bff_config_reloads_total{result="success"}: got %v more, want 2`, got)
+	}
+	if got := testutil.ToFloat64(configReloads.WithLabelValues("failure")) - failure; got != 1 {
+		t.Errorf(`bff_config_reloads_total{result="failure"}: got %v more, want 1`, got)
+	}
+}
@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/martian/v3"
+	"github.com/google/martian/v3/parse"
+	"github.com/imranismail/bff/bffparse"
+	"sigs.k8s.io/yaml"
+)
+
+// ModifierError reports a modifier entry that failed to parse.
+type ModifierError struct {
+	Index int
+	Name  string
+	Err   error
+}
+
+func (e *ModifierError) Error() string {
+	return fmt.Sprintf("modifiers[%d] %s: %v", e.Index, e.Name, e.Err)
+}
+
+// Modifier is a parsed modifier entry along with the name it is registered
+// under.
+type Modifier struct {
+	Name string
+	*parse.Result
+}
+
+// ParseModifiers parses every entry of the YAML modifier list. Entries are
+// parsed independently so that every broken entry is reported, the returned
+// error is a *martian.MultiError of *ModifierError.
+func ParseModifiers(raw []byte) ([]*Modifier, error) {
+	var modifiers []json.RawMessage
+
+	if err := yaml.Unmarshal(raw, &modifiers); err != nil {
+		return nil, err
+	}
+
+	results := make([]*Modifier, 0, len(modifiers))
+	merr := martian.NewMultiError()
+
+	for i, mod := range modifiers {
+		res, err := bffparse.Parse(mod)
+
+		if err != nil {
+			merr.Add(&ModifierError{Index: i, Name: bffparse.Name(mod), Err: err})
+			continue
+		}
+
+		results = append(results, &Modifier{Name: bffparse.Name(mod), Result: res})
+	}
+
+	if !merr.Empty() {
+		return nil, merr
+	}
+
+	return results, nil
+}
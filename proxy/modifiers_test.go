@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/martian/v3"
+	"github.com/google/martian/v3/parse"
+	"github.com/imranismail/bff/bffparse"
+)
+
+func TestParseModifiers(t *testing.T) {
+	raw := []byte(`
+- header.Modifier:
+    scope: [request]
+    name: X-Test
+    value: "1"
+- status.Filter:
+    scope: [response]
+    statusCode: [404]
+    modifier:
+      header.Modifier:
+        name: X-Missing
+        value: "1"
+`)
+
+	modifiers, err := ParseModifiers(raw)
+	if err != nil {
+		t.Fatalf("ParseModifiers(): got %v, want no error", err)
+	}
+
+	var names []string
+
+	for _, mod := range modifiers {
+		names = append(names, mod.Name)
+	}
+
+	if len(names) != 2 || names[0] != "header.Modifier" || names[1] != "status.Filter" {
+		t.Errorf("ParseModifiers() names: got %v, want [header.Modifier status.Filter]", names)
+	}
+}
+
+func TestParseModifiersReportsEveryEntry(t *testing.T) {
+	raw := []byte(`
+- unknown.Modifier: {}
+- header.Modifier:
+    scope: [request]
+    name: X-Test
+    value: "1"
+- status.Filter:
+    scope: [response]
+    modifier:
+      header.Modifier:
+        name: X-Missing
+        value: "1"
+- bff.URLFilter:
+    path: /users/:id<[0-9+>
+`)
+
+	_, err := ParseModifiers(raw)
+
+	merr, ok := err.(*martian.MultiError)
+	if !ok {
+		t.Fatalf("ParseModifiers(): got %v, want *martian.MultiError", err)
+	}
+
+	want := []struct {
+		index int
+		name  string
+	}{
+		{index: 0, name: "unknown.Modifier"},
+		{index: 2, name: "status.Filter"},
+		{index: 3, name: "bff.URLFilter"},
+	}
+
+	errs := merr.Errors()
+
+	if len(errs) != len(want) {
+		t.Fatalf("ParseModifiers(): got %d errors %v, want %d", len(errs), errs, len(want))
+	}
+
+	for i, err := range errs {
+		merr, ok := err.(*ModifierError)
+		if !ok {
+			t.Fatalf("%d. error: got %T, want *ModifierError", i, err)
+		}
+		if merr.Index != want[i].index || merr.Name != want[i].name {
+			t.Errorf("%d. error: got modifiers[%d] %s, want modifiers[%d] %s", i, merr.Index, merr.Name, want[i].index, want[i].name)
+		}
+	}
+}
+
+func TestParseModifiersInvalidYAML(t *testing.T) {
+	if _, err := ParseModifiers([]byte(`header.Modifier: {}`)); err == nil {
+		t.Error("ParseModifiers(): got no error for a map, want error")
+	}
+}
+
+func TestRegisteredCompositesAreKnown(t *testing.T) {
+	// a modifier parsing one of these nested entries fails on the unknown one
+	probes := []string{
+		`"modifier": {"unknown.Modifier": {}}`,
+		`"else": {"unknown.Modifier": {}}`,
+		`"modifiers": [{"unknown.Modifier": {}}]`,
+		`"modifiers": [{"priority": 0, "modifier": {"unknown.Modifier": {}}}]`,
+	}
+
+	for _, name := range modifierNames {
+		for _, probe := range probes {
+			_, err := parse.FromJSON([]byte(`{"` + name + `": {"scope": ["request"], ` + probe + `}}`))
+
+			if err != nil && strings.Contains(err.Error(), "unknown.Modifier") && !bffparse.Composite(name) {
+				t.Errorf("bffparse.Composite(%s): got false for a modifier holding nested entries, want true", name)
+				break
+			}
+		}
+	}
+}
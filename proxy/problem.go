@@ -0,0 +1,193 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/google/martian/v3"
+	"github.com/imranismail/bff/bffparse"
+	"github.com/imranismail/bff/bffroute"
+	"github.com/imranismail/bff/body"
+)
+
+const (
+	problemContentType = "application/problem+json"
+	problemTypePrefix  = "urn:bff:problem:"
+)
+
+// ErrorClass groups the errors caught by the ErrorBoundary by cause, the class
+// decides the status of the problem response.
+type ErrorClass struct {
+	Name   string
+	Status int
+	Title  string
+}
+
+var (
+	// ErrorInternal is any error without a more specific class.
+	ErrorInternal = ErrorClass{"internal-error", http.StatusInternalServerError, "Internal Server Error"}
+	// ErrorInvalidRequest is a failed request verification.
+	ErrorInvalidRequest = ErrorClass{"invalid-request", http.StatusBadRequest, "Bad Request"}
+	// ErrorVerificationFailed is a failed response verification.
+	ErrorVerificationFailed = ErrorClass{"verification-failed", http.StatusBadGateway, "Bad Gateway"}
+	// ErrorNotFound is a request matching no route.
+	ErrorNotFound = ErrorClass{"not-found", http.StatusNotFound, "Not Found"}
+	// ErrorMethodNotAllowed is a request matching a route but not its methods.
+	ErrorMethodNotAllowed = ErrorClass{"method-not-allowed", http.StatusMethodNotAllowed, "Method Not Allowed"}
+	// ErrorCircuitOpen is a resource failed fast by its circuit breaker.
+	ErrorCircuitOpen = ErrorClass{"circuit-open", http.StatusServiceUnavailable, "Service Unavailable"}
+	// ErrorUpstream is a resource that responded with a status it does not
+	// accept.
+	ErrorUpstream = ErrorClass{"upstream-error", http.StatusBadGateway, "Bad Gateway"}
+	// ErrorUpstreamTimeout is an upstream request that timed out.
+	ErrorUpstreamTimeout = ErrorClass{"upstream-timeout", http.StatusGatewayTimeout, "Gateway Timeout"}
+)
+
+// Type returns the problem type URI of the class.
+func (c ErrorClass) Type() string {
+	return problemTypePrefix + c.Name
+}
+
+// Problem is an RFC 7807 problem details object.
+type Problem struct {
+	Type     string         `json:"type"`
+	Title    string         `json:"title"`
+	Status   int            `json:"status"`
+	Detail   string         `json:"detail,omitempty"`
+	Instance string         `json:"instance,omitempty"`
+	Errors   []problemError `json:"errors,omitempty"`
+}
+
+type problemError struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+}
+
+// classifiedError is an error caught by the ErrorBoundary along with its class
+// and the modifier that returned it.
+type classifiedError struct {
+	class    ErrorClass
+	modifier string
+	failure  *bffparse.ModifierFailure
+	err      error
+}
+
+// classify splits err into its individual errors. Errors that don't have a
+// more specific class get the fallback class.
+func classify(err error, fallback ErrorClass) []classifiedError {
+	var errs []classifiedError
+
+	for _, err := range flatten(err) {
+		cerr := classifiedError{class: classOf(err, fallback), err: err}
+
+		var failure *bffparse.ModifierFailure
+
+		if errors.As(err, &failure) {
+			cerr.modifier = failure.Modifier
+			cerr.failure = failure
+		}
+
+		errs = append(errs, cerr)
+	}
+
+	return errs
+}
+
+func classOf(err error, fallback ErrorClass) ErrorClass {
+	var circuitErr *body.CircuitOpenError
+
+	if errors.As(err, &circuitErr) {
+		return ErrorCircuitOpen
+	}
+
+	var routeErr *bffroute.Error
+
+	if errors.As(err, &routeErr) {
+		if routeErr.Status == http.StatusMethodNotAllowed {
+			return ErrorMethodNotAllowed
+		}
+
+		return ErrorNotFound
+	}
+
+	var statusErr *body.StatusError
+
+	if errors.As(err, &statusErr) {
+		return ErrorUpstream
+	}
+
+	var netErr net.Error
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorUpstreamTimeout
+	}
+
+	return fallback
+}
+
+// headerError is an error that sets headers on the error response, such as
+// the Allow header of a 405.
+type headerError interface {
+	Headers() http.Header
+}
+
+// errorHeaders returns the headers set by errs.
+func errorHeaders(errs []classifiedError) http.Header {
+	h := http.Header{}
+
+	for _, err := range errs {
+		var herr headerError
+
+		if errors.As(err.err, &herr) {
+			for key, values := range herr.Headers() {
+				h[key] = values
+			}
+		}
+	}
+
+	return h
+}
+
+// flatten returns the errors nested in martian.MultiErrors.
+func flatten(err error) []error {
+	merr, ok := err.(*martian.MultiError)
+
+	if !ok {
+		return []error{err}
+	}
+
+	var errs []error
+
+	for _, err := range merr.Errors() {
+		errs = append(errs, flatten(err)...)
+	}
+
+	return errs
+}
+
+// newProblem describes errs, the first error decides the status. Error messages
+// are left out when hideDetails is set.
+func newProblem(errs []classifiedError, instance string, hideDetails bool) *Problem {
+	class := errs[0].class
+
+	problem := &Problem{
+		Type:     class.Type(),
+		Title:    class.Title,
+		Status:   class.Status,
+		Instance: instance,
+	}
+
+	if hideDetails {
+		return problem
+	}
+
+	problem.Detail = errs[0].err.Error()
+
+	for _, err := range errs {
+		problem.Errors = append(problem.Errors, problemError{Type: err.class.Type(), Detail: err.err.Error()})
+	}
+
+	return problem
+}
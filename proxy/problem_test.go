@@ -0,0 +1,178 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/google/martian/v3"
+	"github.com/google/martian/v3/martiantest"
+	"github.com/google/martian/v3/proxyutil"
+	"github.com/google/martian/v3/verify"
+	"github.com/imranismail/bff/bffroute"
+	"github.com/imranismail/bff/body"
+)
+
+// newTestBoundary returns an ErrorBoundary around tm and tv.
+func newTestBoundary(tm *martiantest.Modifier, tv *verify.TestVerifier) *ErrorBoundary {
+	eb := NewErrorBoundary()
+	eb.SetRequestModifier(tm)
+	eb.SetResponseModifier(tm)
+	eb.SetRequestVerifier(tv)
+	eb.SetResponseVerifier(tv)
+
+	return eb
+}
+
+func TestClassOf(t *testing.T) {
+	tt := []struct {
+		err  error
+		want ErrorClass
+	}{
+		{err: errors.New("boom"), want: ErrorInternal},
+		{err: &body.CircuitOpenError{Circuit: "example.com"}, want: ErrorCircuitOpen},
+		{err: fmt.Errorf("fetch: %w", &body.CircuitOpenError{Circuit: "example.com"}), want: ErrorCircuitOpen},
+		{err: &bffroute.Error{Status: http.StatusNotFound}, want: ErrorNotFound},
+		{err: &bffroute.Error{Status: http.StatusMethodNotAllowed}, want: ErrorMethodNotAllowed},
+		{err: context.DeadlineExceeded, want: ErrorUpstreamTimeout},
+		{err: &body.StatusError{Resource: "GET http://example.com", StatusCode: 503}, want: ErrorUpstream},
+		{err: fmt.Errorf("fetch: %w", &body.StatusError{Resource: "GET http://example.com", StatusCode: 404}), want: ErrorUpstream},
+	}
+
+	for i, tc := range tt {
+		if got := classOf(tc.err, ErrorInternal); got != tc.want {
+			t.Errorf("%d. classOf(%v): got %s, want %s", i, tc.err, got.Name, tc.want.Name)
+		}
+	}
+}
+
+func TestNewProblem(t *testing.T) {
+	merr := martian.NewMultiError()
+	merr.Add(&body.CircuitOpenError{Circuit: "example.com"})
+	merr.Add(errors.New("boom"))
+
+	errs := classify(merr, ErrorVerificationFailed)
+
+	problem := newProblem(errs, "/users/1", false)
+
+	want := &Problem{
+		Type:     "urn:bff:problem:circuit-open",
+		Title:    "Service Unavailable",
+		Status:   http.StatusServiceUnavailable,
+		Detail:   "body.JSONResource: circuit open for example.com",
+		Instance: "/users/1",
+		Errors: []problemError{
+			{Type: "urn:bff:problem:circuit-open", Detail: "body.JSONResource: circuit open for example.com"},
+			{Type: "urn:bff:problem:verification-failed", Detail: "boom"},
+		},
+	}
+
+	got, _ := json.Marshal(problem)
+	wantJSON, _ := json.Marshal(want)
+
+	if string(got) != string(wantJSON) {
+		t.Errorf("newProblem(): got %s, want %s", got, wantJSON)
+	}
+
+	hidden, _ := json.Marshal(newProblem(errs, "/users/1", true))
+
+	if want := `{"type":"urn:bff:problem:circuit-open","title":"Service Unavailable","status":503,"instance":"/users/1"}`; string(hidden) != want {
+		t.Errorf("newProblem(hideDetails): got %s, want %s", hidden, want)
+	}
+}
+
+func TestErrorBoundaryProblemResponse(t *testing.T) {
+	tt := []struct {
+		resErr    error
+		verifyErr error
+		status    int
+		typ       string
+		allow     string
+	}{
+		{resErr: errors.New("boom"), status: 500, typ: "urn:bff:problem:internal-error"},
+		{verifyErr: errors.New("unexpected status"), status: 502, typ: "urn:bff:problem:verification-failed"},
+		{resErr: &bffroute.Error{Status: 405, Method: "DELETE", Path: "/users/1", Allow: []string{"GET", "PUT"}}, status: 405, typ: "urn:bff:problem:method-not-allowed", allow: "GET, PUT"},
+	}
+
+	for i, tc := range tt {
+		tm := martiantest.NewModifier()
+		tm.ResponseError(tc.resErr)
+		tv := &verify.TestVerifier{ResponseError: tc.verifyErr}
+
+		eb := newTestBoundary(tm, tv)
+
+		req, err := http.NewRequest("GET", "http://example.com/users/1", nil)
+		if err != nil {
+			t.Fatalf("%d. http.NewRequest(): got %v, want no error", i, err)
+		}
+
+		_, remove, err := martian.TestContext(req, nil, nil)
+		if err != nil {
+			t.Fatalf("%d. martian.TestContext(): got %v, want no error", i, err)
+		}
+
+		res := proxyutil.NewResponse(200, nil, req)
+		res.Header.Set("Content-Encoding", "gzip")
+
+		if err := eb.ModifyResponse(res); err != nil {
+			t.Fatalf("%d. ModifyResponse(): got %v, want no error", i, err)
+		}
+
+		if got := res.StatusCode; got != tc.status {
+			t.Errorf("%d. res.StatusCode: got %d, want %d", i, got, tc.status)
+		}
+		if got, want := res.Header.Get("Content-Type"), "application/problem+json"; got != want {
+			t.Errorf("%d. Content-Type: got %q, want %q", i, got, want)
+		}
+		if got := res.Header.Get("Content-Encoding"); got != "" {
+			t.Errorf("%d. Content-Encoding: got %q, want none", i, got)
+		}
+		if got := res.Header.Get("Allow"); got != tc.allow {
+			t.Errorf("%d. Allow: got %q, want %q", i, got, tc.allow)
+		}
+
+		b, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatalf("%d. ioutil.ReadAll(): got %v, want no error", i, err)
+		}
+
+		problem := &Problem{}
+		if err := json.Unmarshal(b, problem); err != nil {
+			t.Fatalf("%d. json.Unmarshal(%s): got %v, want no error", i, b, err)
+		}
+		if problem.Type != tc.typ || problem.Status != tc.status || problem.Instance != "/users/1" {
+			t.Errorf("%d. problem: got %s, want type %s, status %d, instance /users/1", i, b, tc.typ, tc.status)
+		}
+
+		remove()
+	}
+}
+
+func TestErrorBoundaryNoErrors(t *testing.T) {
+	eb := newTestBoundary(martiantest.NewModifier(), &verify.TestVerifier{})
+
+	req, err := http.NewRequest("GET", "http://example.com/users/1", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest(): got %v, want no error", err)
+	}
+
+	_, remove, err := martian.TestContext(req, nil, nil)
+	if err != nil {
+		t.Fatalf("martian.TestContext(): got %v, want no error", err)
+	}
+	defer remove()
+
+	res := proxyutil.NewResponse(201, nil, req)
+	res.Header.Set("Content-Type", "application/json")
+
+	if err := eb.ModifyResponse(res); err != nil {
+		t.Fatalf("ModifyResponse(): got %v, want no error", err)
+	}
+	if res.StatusCode != 201 || res.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("res: got %d %s, want the response untouched", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+}
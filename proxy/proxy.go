@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -9,18 +10,21 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/google/martian/v3"
-	"github.com/google/martian/v3/httpspec"
-	"github.com/google/martian/v3/parse"
 	"github.com/imranismail/bff/bfflog"
+	"github.com/imranismail/bff/bffparse"
+	"github.com/imranismail/bff/body"
 	"github.com/imranismail/bff/healthcheck"
+	"github.com/imranismail/bff/tracing"
+	"github.com/imranismail/bff/transport"
+	"github.com/imranismail/bff/upstream"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"sigs.k8s.io/yaml"
 
-	// martian built-in modifiers
+	// martian built-in modifiers, their names are listed in admin.go
 	_ "github.com/google/martian/v3/body"
 	_ "github.com/google/martian/v3/cookie"
 	_ "github.com/google/martian/v3/failure"
@@ -38,24 +42,33 @@ import (
 	_ "github.com/google/martian/v3/status"
 	_ "github.com/imranismail/bff/bffmethod"
 	_ "github.com/imranismail/bff/bffquerystring"
+	_ "github.com/imranismail/bff/bffroute"
 	_ "github.com/imranismail/bff/bffstatus"
 	_ "github.com/imranismail/bff/bffurl"
-	_ "github.com/imranismail/bff/body"
 	"github.com/imranismail/bff/config"
 	"github.com/imranismail/bff/log"
 )
 
 var Proxy *martian.Proxy
 
+// Modifiers is the modifier stack served by Proxy.
+var Modifiers = NewStack()
+
 // Serve start the webserver
 func Serve(cmd *cobra.Command, args []string) {
 	proxy := martian.NewProxy()
-	defer proxy.Close()
 
 	Proxy = proxy
 
-	if url, err := url.Parse(viper.GetString("url")); err != nil {
-		proxy.SetDownstreamProxy(url)
+	if raw := viper.GetString("url"); raw != "" {
+		u, err := url.Parse(raw)
+
+		if err != nil {
+			log.Errorf("url: %v", err)
+			os.Exit(1)
+		}
+
+		proxy.SetDownstreamProxy(u)
 	}
 
 	proxy.SetRoundTripper(&http.Transport{
@@ -70,7 +83,18 @@ func Serve(cmd *cobra.Command, args []string) {
 		},
 	})
 
-	configureProxy(proxy)
+	if err := configureTracing(); err != nil {
+		log.Errorf("%s", err)
+		os.Exit(1)
+	}
+
+	if err := Configure(); err != nil {
+		log.Errorf("%s", err)
+		os.Exit(1)
+	}
+
+	proxy.SetRequestModifier(Modifiers)
+	proxy.SetResponseModifier(Modifiers)
 
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", viper.GetString("port")))
 
@@ -79,69 +103,216 @@ func Serve(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	certs, err := newCertReloader()
+
+	if err != nil {
+		log.Errorf("%s", err)
+		os.Exit(1)
+	}
+
+	if certs != nil {
+		if err := certs.Watch(); err != nil {
+			log.Errorf("%s", err)
+			os.Exit(1)
+		}
+
+		defer certs.Close()
+
+		listener = newTLSListener(listener, certs.TLSConfig(), proxy, Modifiers)
+
+		log.Infof("bff: terminating TLS with %s", certs.certFile)
+	}
+
 	log.Infof("bff: starting proxy %s on %s", config.Version, listener.Addr().String())
 
 	go proxy.Serve(listener)
 
+	var admin *http.Server
+
+	if port := viper.GetString("adminPort"); port != "" {
+		if admin, err = serveAdmin(viper.GetString("adminAddress"), port); err != nil {
+			log.Errorf("%s", err)
+			os.Exit(1)
+		}
+	}
+
 	sigc := make(chan os.Signal, 1)
-	signal.Notify(sigc, os.Interrupt, os.Kill)
+	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+
+	sig := <-sigc
+
+	log.Infof("bff: received %s, draining connections", sig)
 
-	<-sigc
+	shutdown(proxy, listener, viper.GetDuration("drainDelay"), viper.GetDuration("drainTimeout"))
+
+	if admin != nil {
+		admin.Close()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := tracing.Shutdown(ctx); err != nil {
+		log.Errorf("bff: exporting spans: %v", err)
+	}
 
 	log.Infof("bff: shutting down")
 }
 
-func Configure() {
-	configureProxy(Proxy)
+// shutdown marks the healthcheck as failing and keeps serving for delay, so
+// that readiness probes take the instance out of rotation. It then waits up to
+// timeout for the in-flight requests to finish and only then closes the
+// listener. A non-positive timeout waits indefinitely.
+func shutdown(proxy *martian.Proxy, listener net.Listener, delay, timeout time.Duration) {
+	healthcheck.SetDraining(true)
+
+	if delay > 0 {
+		log.Infof("bff: failing healthchecks for %s before draining", delay)
+		time.Sleep(delay)
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		proxy.Close()
+
+		if tl, ok := listener.(*tlsListener); ok {
+			tl.Drain()
+		}
+
+		close(done)
+	}()
+
+	var expired <-chan time.Time
+
+	if timeout > 0 {
+		expired = time.After(timeout)
+	}
+
+	select {
+	case <-done:
+		log.Infof("bff: drained all connections")
+	case <-expired:
+		log.Errorf("bff: drain timeout of %s exceeded, dropping in-flight requests", timeout)
+	}
+
+	listener.Close()
+}
+
+// BuildTransports builds the upstream transports of the current config without
+// publishing them.
+func BuildTransports() (*transport.Registry, error) {
+	configs := make(map[string]transport.Config)
+	raw, err := json.Marshal(viper.Get("transports"))
+
+	if err != nil {
+		return nil, fmt.Errorf("transports: %v", err)
+	}
+
+	if err := json.Unmarshal(raw, &configs); err != nil {
+		return nil, fmt.Errorf("transports: %v", err)
+	}
+
+	insecure := viper.GetBool("insecure")
+
+	return transport.Build(configs, transport.Config{
+		Insecure: &insecure,
+		Proxy:    viper.GetString("url"),
+	})
+}
+
+// NewBoundary builds the complete modifier stack from the current config
+// without installing it or its transports.
+func NewBoundary() (*ErrorBoundary, error) {
+	eb, _, err := newBoundary([]byte(viper.GetString("modifiers")))
+
+	return eb, err
 }
 
-func configureProxy(*martian.Proxy) {
-	outer, inner := httpspec.NewStack("bff")
+// newBoundary builds the modifier stack of the raw modifiers config and the
+// transports it fetches resources through, neither is installed.
+func newBoundary(modifiers []byte) (*ErrorBoundary, *transport.Registry, error) {
+	trusted, err := ParseTrustedProxies(viper.GetStringSlice("trustedProxies"))
 
-	main := NewErrorBoundary()
-	Proxy.SetRequestModifier(main)
-	Proxy.SetResponseModifier(main)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	outer, inner := newHTTPStack("bff", &forwardedModifier{trusted: trusted})
 
+	main := NewErrorBoundary()
 	main.SetRequestModifier(outer)
 	main.SetResponseModifier(outer)
 	main.SetRequestVerifier(outer)
 	main.SetResponseVerifier(outer)
+	main.SetHideDetails(viper.GetBool("hideErrorDetails"))
+
+	rules, err := ParseErrorRules([]byte(viper.GetString("errors")))
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	main.SetErrorRules(rules)
 
 	hcm := healthcheck.NewModifier(200)
 	outer.AddRequestModifier(hcm)
 	outer.AddResponseModifier(hcm)
 
-	var modifiers []json.RawMessage
+	var def *url.URL
 
-	err := yaml.Unmarshal([]byte(viper.GetString("modifiers")), &modifiers)
+	if raw := viper.GetString("upstream"); raw != "" {
+		if def, err = upstream.Parse(raw); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	resolver := upstream.NewResolver(def)
+	inner.AddRequestModifier(resolver.Start())
+	inner.AddResponseModifier(resolver)
+
+	transports, err := BuildTransports()
 
 	if err != nil {
-		log.Errorf("%s", err)
-		os.Exit(1)
+		return nil, nil, err
 	}
 
-	for _, mod := range modifiers {
-		res, err := parse.FromJSON(mod)
+	// resources name the transports being built, not the published ones
+	defer transport.Stage(transports)()
 
-		if err != nil {
-			log.Errorf("%s", err)
-			os.Exit(1)
-		}
+	referencesBody := body.TrackBodyReferences()
+	results, err := ParseModifiers(modifiers)
+	recordBody := referencesBody()
 
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// request bodies are only buffered for the resources referencing them
+	if recordBody {
+		inner.AddRequestModifier(body.NewRequestBodyRecorder())
+	}
+
+	for _, res := range results {
 		reqmod := res.RequestModifier()
 
 		if reqmod != nil {
-			inner.AddRequestModifier(reqmod)
+			inner.AddRequestModifier(bffparse.NewRequestModifier(res.Name, reqmod))
 		}
 
 		resmod := res.ResponseModifier()
 
 		if resmod != nil {
-			inner.AddResponseModifier(resmod)
+			inner.AddResponseModifier(bffparse.NewResponseModifier(res.Name, resmod))
 		}
 	}
 
+	// after the healthcheck, which matches the path bff received
+	outer.AddRequestModifier(resolver)
+
 	ml := bfflog.NewLogger()
 	outer.AddRequestModifier(ml)
 	outer.AddResponseModifier(ml)
+
+	return main, transports, nil
 }
@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/imranismail/bff/log"
+	"github.com/spf13/viper"
+)
+
+// reloadMu serializes the reloads of the admin API and the config watcher,
+// viper is not safe for concurrent reads of the config file.
+var reloadMu sync.Mutex
+
+// Configure rebuilds the modifier stack from the current config, the running
+// stack is left untouched if it fails.
+func Configure() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	return Modifiers.Reload()
+}
+
+// ReloadConfig reads the config file again, when there is one, and rebuilds
+// the modifier stack from it. The log settings are only applied once the stack
+// is rebuilt.
+func ReloadConfig() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	if viper.ConfigFileUsed() == "" {
+		return Modifiers.Reload()
+	}
+
+	if err := viper.ReadInConfig(); err != nil {
+		return err
+	}
+
+	if err := log.Validate(); err != nil {
+		return err
+	}
+
+	if err := Modifiers.Reload(); err != nil {
+		return err
+	}
+
+	return log.Configure()
+}
+
+// WatchConfig reloads the config whenever file changes, including when the
+// symlink it resolves to is swapped like a Kubernetes ConfigMap.
+func WatchConfig(file string) error {
+	watcher, err := fsnotify.NewWatcher()
+
+	if err != nil {
+		return fmt.Errorf("config: %v", err)
+	}
+
+	file = filepath.Clean(file)
+
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		watcher.Close()
+		return fmt.Errorf("config: %v", err)
+	}
+
+	realFile, _ := filepath.EvalSymlinks(file)
+
+	go func() {
+		defer watcher.Close()
+
+		for {
+			select {
+			case evt, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				current, _ := filepath.EvalSymlinks(file)
+				changed := filepath.Clean(evt.Name) == file && evt.Op&(fsnotify.Write|fsnotify.Create) != 0
+
+				if !changed && (current == "" || current == realFile) {
+					continue
+				}
+
+				realFile = current
+
+				log.Infof("Reconfiguring: %v", evt.Name)
+
+				if err := ReloadConfig(); err != nil {
+					log.Errorf("Reconfiguring: %v, keeping previous modifiers (%d failed reloads)", err, Modifiers.ReloadFailures())
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+
+				log.Errorf("bff: watching config: %v", err)
+			}
+		}
+	}()
+
+	return nil
+}
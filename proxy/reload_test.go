@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/imranismail/bff/log"
+	"github.com/imranismail/bff/transport"
+	"github.com/spf13/viper"
+)
+
+func TestReloadConfigLogSettings(t *testing.T) {
+	defer viper.Reset()
+	defer transport.Publish(&transport.Registry{})
+	defer log.SetLevel(log.Level())
+
+	file := filepath.Join(t.TempDir(), "config.yml")
+	viper.SetConfigFile(file)
+
+	tt := []struct {
+		config string
+		ok     bool
+		level  string
+	}{
+		{config: "verbosity: info\nmodifiers: '[]'\n", ok: true, level: "info"},
+		// an unparsable verbosity rejects the reload instead of exiting
+		{config: "verbosity: loud\nmodifiers: '[]'\n", level: "info"},
+		// the log settings of a rejected stack are not applied
+		{config: "verbosity: debug\nmodifiers: '[{\"unknown.Modifier\": {}}]'\n", level: "info"},
+		{config: "verbosity: debug\nmodifiers: '[]'\n", ok: true, level: "debug"},
+	}
+
+	for i, tc := range tt {
+		if err := ioutil.WriteFile(file, []byte(tc.config), 0644); err != nil {
+			t.Fatalf("%d. ioutil.WriteFile(): got %v, want no error", i, err)
+		}
+
+		if err := ReloadConfig(); (err == nil) != tc.ok {
+			t.Errorf("%d. ReloadConfig(): got %v, want error %t", i, err, !tc.ok)
+		}
+		if got := log.Level(); got != tc.level {
+			t.Errorf("%d. log.Level(): got %s, want %s", i, got, tc.level)
+		}
+	}
+}
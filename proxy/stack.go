@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/martian/v3"
+	"github.com/imranismail/bff/bffurl"
+	"github.com/imranismail/bff/body"
+	"github.com/imranismail/bff/transport"
+	"github.com/spf13/viper"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	stackContextKey = "proxy.Stack"
+	startContextKey = "proxy.Stack.Start"
+)
+
+// Stack holds the active modifier stack and swaps it atomically on reload, a
+// request keeps using the stack it started with until its response is written.
+type Stack struct {
+	active   atomic.Value
+	reloads  uint64
+	failures uint64
+}
+
+// activeStack is the ErrorBoundary of a stack along with its config, they are
+// swapped together.
+type activeStack struct {
+	boundary *ErrorBoundary
+	loaded   *LoadedConfig
+}
+
+// LoadedConfig describes the modifiers config of a stack.
+type LoadedConfig struct {
+	Modifiers json.RawMessage `json:"modifiers"`
+	Version   string          `json:"version"`
+	LoadedAt  time.Time       `json:"loadedAt"`
+}
+
+// NewStack returns an empty Stack, Reload has to succeed once before it can
+// serve requests.
+func NewStack() *Stack {
+	return &Stack{}
+}
+
+// Reload builds a new modifier stack and its transports from the current
+// config and swaps them in. The previous stack and transports are kept when
+// the new ones fail to build.
+func (s *Stack) Reload() error {
+	raw := viper.GetString("modifiers")
+	eb, transports, err := newBoundary([]byte(raw))
+
+	if err != nil {
+		atomic.AddUint64(&s.failures, 1)
+		configReloads.WithLabelValues("failure").Inc()
+
+		return err
+	}
+
+	modifiers, err := yaml.YAMLToJSON([]byte(raw))
+
+	if err != nil {
+		modifiers = []byte("null")
+	}
+
+	sum := sha256.Sum256([]byte(raw))
+
+	transport.Publish(transports)
+	s.active.Store(&activeStack{
+		boundary: eb,
+		loaded: &LoadedConfig{
+			Modifiers: modifiers,
+			Version:   hex.EncodeToString(sum[:6]),
+			LoadedAt:  time.Now(),
+		},
+	})
+	atomic.AddUint64(&s.reloads, 1)
+	configReloads.WithLabelValues("success").Inc()
+
+	// breakers of hosts the new stack no longer fetches are left behind
+	body.PruneCircuitBreakers()
+
+	return nil
+}
+
+// Reloads returns the number of successful reloads.
+func (s *Stack) Reloads() uint64 {
+	return atomic.LoadUint64(&s.reloads)
+}
+
+// ReloadFailures returns the number of failed reloads.
+func (s *Stack) ReloadFailures() uint64 {
+	return atomic.LoadUint64(&s.failures)
+}
+
+// Loaded returns the config of the active stack, nil before the first reload.
+func (s *Stack) Loaded() *LoadedConfig {
+	if active, ok := s.active.Load().(*activeStack); ok {
+		return active.loaded
+	}
+
+	return nil
+}
+
+// Boundary returns the active ErrorBoundary.
+func (s *Stack) Boundary() *ErrorBoundary {
+	if active, ok := s.active.Load().(*activeStack); ok {
+		return active.boundary
+	}
+
+	return nil
+}
+
+// ModifyRequest runs the active stack and pins it to the request context, the
+// request is traced when tracing is enabled.
+func (s *Stack) ModifyRequest(req *http.Request) error {
+	eb := s.Boundary()
+
+	ctx := martian.NewContext(req)
+	ctx.Set(stackContextKey, eb)
+	ctx.Set(startContextKey, time.Now())
+
+	startRequestSpan(ctx, req)
+
+	err := eb.ModifyRequest(req)
+
+	startUpstreamSpan(ctx, req)
+
+	return err
+}
+
+// ModifyResponse runs the stack the request was started with and records the
+// request metrics and spans.
+func (s *Stack) ModifyResponse(res *http.Response) error {
+	eb := s.Boundary()
+
+	ctx := martian.NewContext(res.Request)
+
+	if pinned, ok := ctx.Get(stackContextKey); ok {
+		eb = pinned.(*ErrorBoundary)
+	}
+
+	endUpstreamSpan(ctx, res)
+
+	err := eb.ModifyResponse(res)
+
+	endRequestSpan(ctx, res)
+
+	if start, ok := ctx.Get(startContextKey); ok {
+		route := bffurl.Route(ctx)
+
+		if route == "" {
+			route = "unmatched"
+		}
+
+		requestsTotal.WithLabelValues(route, res.Request.Method, strconv.Itoa(res.StatusCode)).Inc()
+		requestDuration.WithLabelValues(route, res.Request.Method).Observe(time.Since(start.(time.Time)).Seconds())
+	}
+
+	return err
+}
@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/imranismail/bff/transport"
+	"github.com/spf13/viper"
+)
+
+func TestStackReloadKeepsPreviousOnFailure(t *testing.T) {
+	defer viper.Reset()
+	defer transport.Publish(&transport.Registry{})
+
+	s := NewStack()
+
+	viper.Set("modifiers", `[{"header.Modifier": {"scope": ["request"], "name": "X-Test", "value": "1"}}]`)
+
+	if err := s.Reload(); err != nil {
+		t.Fatalf("s.Reload(): got %v, want no error", err)
+	}
+
+	eb, loaded := s.Boundary(), s.Loaded()
+
+	viper.Set("transports", map[string]interface{}{"internal": map[string]interface{}{}})
+	viper.Set("modifiers", `[{"body.JSONResource": {"url": "http://example.com", "transport": "internal", "modifier": {"unknown.Modifier": {}}}}]`)
+
+	if err := s.Reload(); err == nil {
+		t.Fatal("s.Reload(): got no error, want error")
+	}
+
+	if s.Boundary() != eb || s.Loaded() != loaded {
+		t.Error("s.Boundary(), s.Loaded(): got a new stack after a failed reload, want the previous one")
+	}
+	if _, err := transport.Get("internal"); err == nil {
+		t.Error("transport.Get(internal): got no error after a failed reload, want error")
+	}
+	if got, want := s.ReloadFailures(), uint64(1); got != want {
+		t.Errorf("s.ReloadFailures(): got %d, want %d", got, want)
+	}
+
+	viper.Set("modifiers", `[{"body.JSONResource": {"url": "http://example.com", "transport": "internal"}}]`)
+
+	if err := s.Reload(); err != nil {
+		t.Fatalf("s.Reload(): got %v, want no error", err)
+	}
+	if _, err := transport.Get("internal"); err != nil {
+		t.Errorf("transport.Get(internal): got %v after a reload, want no error", err)
+	}
+}
@@ -0,0 +1,220 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/imranismail/bff/log"
+	"github.com/spf13/viper"
+)
+
+// certReloader holds the certificate and client CAs of the tls config, they
+// are read again whenever one of their files changes so certificates can be
+// rotated without a restart.
+type certReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	clientAuth   tls.ClientAuthType
+	nextProtos   []string
+
+	config  atomic.Value // *tls.Config
+	watcher *fsnotify.Watcher
+}
+
+// parseClientAuth returns the client certificate policy of a tls.clientAuth
+// setting.
+func parseClientAuth(s string) (tls.ClientAuthType, error) {
+	switch strings.ToLower(s) {
+	case "", "none":
+		return tls.NoClientCert, nil
+	case "optional":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("tls: unknown clientAuth %q, want none, optional or require", s)
+	}
+}
+
+// newCertReloader returns the certReloader of the tls config, nil when TLS is
+// not configured.
+func newCertReloader() (*certReloader, error) {
+	certFile := viper.GetString("tls.certFile")
+	keyFile := viper.GetString("tls.keyFile")
+	clientCAFile := viper.GetString("tls.clientCAFile")
+
+	if certFile == "" && keyFile == "" {
+		if clientCAFile != "" {
+			return nil, fmt.Errorf("tls: clientCAFile is set without certFile and keyFile")
+		}
+
+		return nil, nil
+	}
+
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("tls: certFile and keyFile must be set together")
+	}
+
+	clientAuth, err := parseClientAuth(viper.GetString("tls.clientAuth"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	// client certificates are verified against clientCAFile, it implies
+	// require unless clientAuth says otherwise
+	if clientCAFile != "" && !viper.IsSet("tls.clientAuth") {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if clientAuth != tls.NoClientCert && clientCAFile == "" {
+		return nil, fmt.Errorf("tls: clientAuth %s needs a clientCAFile", viper.GetString("tls.clientAuth"))
+	}
+
+	nextProtos := []string{"http/1.1"}
+
+	if !viper.IsSet("tls.http2") || viper.GetBool("tls.http2") {
+		nextProtos = []string{"h2", "http/1.1"}
+	}
+
+	r := &certReloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+		clientAuth:   clientAuth,
+		nextProtos:   nextProtos,
+	}
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// load reads the certificate files, the previous config is kept on failure.
+func (r *certReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+
+	if err != nil {
+		return fmt.Errorf("tls: %v", err)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   r.clientAuth,
+		NextProtos:   r.nextProtos,
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if r.clientCAFile != "" {
+		pem, err := ioutil.ReadFile(r.clientCAFile)
+
+		if err != nil {
+			return fmt.Errorf("tls: %v", err)
+		}
+
+		pool := x509.NewCertPool()
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("tls: no certificates found in %s", r.clientCAFile)
+		}
+
+		config.ClientCAs = pool
+	}
+
+	r.config.Store(config)
+
+	return nil
+}
+
+// TLSConfig returns the config of the listener, every handshake uses the
+// latest certificates.
+func (r *certReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		NextProtos: r.nextProtos,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.config.Load().(*tls.Config), nil
+		},
+	}
+}
+
+// Watch reloads the certificates when their files change. The directories are
+// watched rather than the files so that replacing a file, or the symlink swap
+// of a Kubernetes secret volume, is noticed too.
+func (r *certReloader) Watch() error {
+	watcher, err := fsnotify.NewWatcher()
+
+	if err != nil {
+		return fmt.Errorf("tls: %v", err)
+	}
+
+	files := make(map[string]bool)
+	dirs := make(map[string]bool)
+
+	for _, file := range []string{r.certFile, r.keyFile, r.clientCAFile} {
+		if file == "" {
+			continue
+		}
+
+		files[filepath.Clean(file)] = true
+		dirs[filepath.Dir(file)] = true
+	}
+
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("tls: %v", err)
+		}
+	}
+
+	r.watcher = watcher
+
+	go func() {
+		for {
+			select {
+			case evt, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				if !files[filepath.Clean(evt.Name)] && filepath.Base(evt.Name) != "..data" {
+					continue
+				}
+
+				if evt.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+					continue
+				}
+
+				if err := r.load(); err != nil {
+					log.Errorf("bff: reloading certificates: %v, keeping previous certificates", err)
+					continue
+				}
+
+				log.Infof("bff: reloaded certificates: %v", evt.Name)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+
+				log.Errorf("bff: watching certificates: %v", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Close stops watching the certificate files.
+func (r *certReloader) Close() {
+	if r.watcher != nil {
+		r.watcher.Close()
+	}
+}
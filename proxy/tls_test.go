@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// writeTestCert writes a self-signed certificate for localhost and its key to
+// certFile and keyFile, replacing them the way a secret rotation does.
+func writeTestCert(t *testing.T, certFile, keyFile, commonName string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey(): got %v, want no error", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate(): got %v, want no error", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("x509.MarshalECPrivateKey(): got %v, want no error", err)
+	}
+
+	// the key is swapped first, the certificate files are only consistent
+	// again once both are
+	writeAtomic(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	writeAtomic(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func writeAtomic(t *testing.T, file string, b []byte) {
+	t.Helper()
+
+	tmp := file + ".tmp"
+
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		t.Fatalf("os.WriteFile(): got %v, want no error", err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		t.Fatalf("os.Rename(): got %v, want no error", err)
+	}
+}
+
+// commonName returns the common name of the certificate served by r.
+func commonName(t *testing.T, r *certReloader) string {
+	t.Helper()
+
+	config, err := r.TLSConfig().GetConfigForClient(nil)
+	if err != nil {
+		t.Fatalf("GetConfigForClient(): got %v, want no error", err)
+	}
+
+	cert, err := x509.ParseCertificate(config.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatalf("x509.ParseCertificate(): got %v, want no error", err)
+	}
+
+	return cert.Subject.CommonName
+}
+
+func TestParseClientAuth(t *testing.T) {
+	tt := []struct {
+		value string
+		want  tls.ClientAuthType
+	}{
+		{value: "", want: tls.NoClientCert},
+		{value: "none", want: tls.NoClientCert},
+		{value: "optional", want: tls.VerifyClientCertIfGiven},
+		{value: "Require", want: tls.RequireAndVerifyClientCert},
+	}
+
+	for i, tc := range tt {
+		got, err := parseClientAuth(tc.value)
+		if err != nil {
+			t.Fatalf("%d. parseClientAuth(%q): got %v, want no error", i, tc.value, err)
+		}
+		if got != tc.want {
+			t.Errorf("%d. parseClientAuth(%q): got %v, want %v", i, tc.value, got, tc.want)
+		}
+	}
+
+	if _, err := parseClientAuth("always"); err == nil {
+		t.Error("parseClientAuth(always): got no error, want error")
+	}
+}
+
+func TestCertReloaderReloadsSwappedFiles(t *testing.T) {
+	defer viper.Reset()
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+
+	writeTestCert(t, certFile, keyFile, "first")
+
+	viper.Set("tls.certFile", certFile)
+	viper.Set("tls.keyFile", keyFile)
+
+	r, err := newCertReloader()
+	if err != nil {
+		t.Fatalf("newCertReloader(): got %v, want no error", err)
+	}
+
+	if err := r.Watch(); err != nil {
+		t.Fatalf("r.Watch(): got %v, want no error", err)
+	}
+	defer r.Close()
+
+	if got, want := commonName(t, r), "first"; got != want {
+		t.Fatalf("certificate: got %q, want %q", got, want)
+	}
+
+	writeTestCert(t, certFile, keyFile, "second")
+
+	for deadline := time.Now().Add(5 * time.Second); commonName(t, r) != "second"; {
+		if time.Now().After(deadline) {
+			t.Fatalf("certificate: got %q after the files were swapped, want %q", commonName(t, r), "second")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// a broken file keeps the previous certificate
+	writeAtomic(t, certFile, []byte("not a certificate"))
+	time.Sleep(100 * time.Millisecond)
+
+	if got, want := commonName(t, r), "second"; got != want {
+		t.Errorf("certificate: got %q after a broken swap, want %q", got, want)
+	}
+}
@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/google/martian/v3"
+	"github.com/imranismail/bff/bffurl"
+	"github.com/imranismail/bff/tracing"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const upstreamSpanKey = "proxy.Stack.UpstreamSpan"
+
+// configureTracing sets up the span exporter of the tracing config.
+func configureTracing() error {
+	var exporter sdktrace.SpanExporter
+
+	switch kind := viper.GetString("tracing.exporter"); kind {
+	case "":
+		return nil
+	case "otlp":
+		endpoint := viper.GetString("tracing.endpoint")
+
+		if endpoint == "" {
+			endpoint = "http://localhost:4318/v1/traces"
+		}
+
+		u, err := url.Parse(endpoint)
+
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("tracing: invalid endpoint %q", endpoint)
+		}
+
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host), otlptracehttp.WithURLPath(u.Path)}
+
+		if u.Scheme == "http" {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+
+		exporter, err = otlptracehttp.New(context.Background(), opts...)
+
+		if err != nil {
+			return fmt.Errorf("tracing: %v", err)
+		}
+	case "stdout":
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+
+		if err != nil {
+			return fmt.Errorf("tracing: %v", err)
+		}
+
+		exporter = exp
+	case "file":
+		f, err := os.OpenFile(viper.GetString("tracing.file"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+
+		if err != nil {
+			return fmt.Errorf("tracing: %v", err)
+		}
+
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(f))
+
+		if err != nil {
+			return fmt.Errorf("tracing: %v", err)
+		}
+
+		exporter = exp
+	default:
+		return fmt.Errorf("tracing: unknown exporter %q", kind)
+	}
+
+	serviceName := viper.GetString("tracing.serviceName")
+
+	if serviceName == "" {
+		serviceName = "bff"
+	}
+
+	sampleRatio := 1.0
+
+	if viper.IsSet("tracing.sampleRatio") {
+		sampleRatio = viper.GetFloat64("tracing.sampleRatio")
+	}
+
+	tracing.Configure(exporter, serviceName, sampleRatio)
+
+	return nil
+}
+
+// startRequestSpan starts the server span of a request, continuing the trace
+// of its traceparent header.
+func startRequestSpan(ctx *martian.Context, req *http.Request) {
+	c, span := tracing.Start(tracing.Extract(req.Header), req.Method, trace.SpanKindServer)
+	span.SetAttributes(
+		attribute.String("http.method", req.Method),
+		attribute.String("http.url", req.URL.String()),
+	)
+
+	tracing.SetContext(ctx, c)
+}
+
+// startUpstreamSpan starts the client span of the proxied round trip and
+// propagates it upstream.
+func startUpstreamSpan(ctx *martian.Context, req *http.Request) {
+	if ctx.SkippingRoundTrip() {
+		return
+	}
+
+	c, span := tracing.Start(tracing.Context(ctx), "upstream "+req.Method, trace.SpanKindClient)
+	span.SetAttributes(
+		attribute.String("http.method", req.Method),
+		attribute.String("http.url", req.URL.String()),
+	)
+
+	tracing.Inject(c, req.Header)
+	ctx.Set(upstreamSpanKey, span)
+}
+
+// endUpstreamSpan ends the client span of the proxied round trip.
+func endUpstreamSpan(ctx *martian.Context, res *http.Response) {
+	if span, ok := ctx.Get(upstreamSpanKey); ok {
+		span := span.(trace.Span)
+		span.SetAttributes(attribute.Int("http.status_code", res.StatusCode))
+		span.End()
+	}
+}
+
+// endRequestSpan ends the server span of a request.
+func endRequestSpan(ctx *martian.Context, res *http.Response) {
+	span := trace.SpanFromContext(tracing.Context(ctx))
+
+	if route := bffurl.Route(ctx); route != "" {
+		span.SetName(res.Request.Method + " " + route)
+		span.SetAttributes(attribute.String("http.route", route))
+	}
+
+	span.SetAttributes(attribute.Int("http.status_code", res.StatusCode))
+
+	if res.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(res.StatusCode))
+	}
+
+	span.End()
+}
@@ -0,0 +1,45 @@
+// Package roundtrip runs requests read outside of martian.Proxy through a
+// modifier stack and upstream, the way martian.Proxy handles the requests it
+// reads itself.
+package roundtrip
+
+import (
+	"net/http"
+
+	"github.com/google/martian/v3"
+	"github.com/google/martian/v3/proxyutil"
+	"github.com/imranismail/bff/log"
+)
+
+// Do modifies req with mod, sends it through rt unless a modifier skipped the
+// round trip and returns the response modified by mod. Errors are reported in
+// Warning headers like martian.Proxy does, so a response is always returned.
+// req must be linked to a martian context, see martian.TestContext.
+func Do(req *http.Request, mod martian.RequestResponseModifier, rt http.RoundTripper) *http.Response {
+	ctx := martian.NewContext(req)
+
+	if err := mod.ModifyRequest(req); err != nil {
+		log.Errorf("bff: error modifying request: %v", err)
+		proxyutil.Warning(req.Header, err)
+	}
+
+	var res *http.Response
+	var err error
+
+	if ctx != nil && ctx.SkippingRoundTrip() {
+		res = proxyutil.NewResponse(200, nil, req)
+	} else if res, err = rt.RoundTrip(req); err != nil {
+		log.Errorf("bff: failed to round trip: %v", err)
+		res = proxyutil.NewResponse(502, nil, req)
+		proxyutil.Warning(res.Header, err)
+	}
+
+	res.Request = req
+
+	if err := mod.ModifyResponse(res); err != nil {
+		log.Errorf("bff: error modifying response: %v", err)
+		proxyutil.Warning(res.Header, err)
+	}
+
+	return res
+}
@@ -0,0 +1,109 @@
+// Package tracing sets up the OpenTelemetry tracer provider of bff and carries
+// the current span of a request in its martian context, from the modifier
+// that started it to the ones nested in it.
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/google/martian/v3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	contextKey = "tracing.Context"
+	scopeName  = "github.com/imranismail/bff"
+)
+
+var (
+	// spans are propagated with the W3C traceparent header
+	propagator = propagation.TraceContext{}
+
+	mu       sync.Mutex
+	provider *sdktrace.TracerProvider
+)
+
+// Configure enables tracing, spans are batched and sent through exporter.
+// New traces are sampled at sampleRatio, the others follow their parent.
+func Configure(exporter sdktrace.SpanExporter, serviceName string, sampleRatio float64) {
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	)
+
+	otel.SetTracerProvider(tp)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	provider = tp
+}
+
+// Shutdown exports the queued spans and stops the exporter.
+func Shutdown(ctx context.Context) error {
+	mu.Lock()
+	tp := provider
+	provider = nil
+	mu.Unlock()
+
+	if tp == nil {
+		return nil
+	}
+
+	return tp.Shutdown(ctx)
+}
+
+// Start starts a span, a child of the span of parent if any. Spans record
+// nothing until Configure is called.
+func Start(parent context.Context, name string, kind trace.SpanKind) (context.Context, trace.Span) {
+	return otel.Tracer(scopeName).Start(parent, name, trace.WithSpanKind(kind))
+}
+
+// SetError marks span as failed with err, a nil err is ignored.
+func SetError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Extract returns the context of the traceparent header of h.
+func Extract(h http.Header) context.Context {
+	return propagator.Extract(context.Background(), propagation.HeaderCarrier(h))
+}
+
+// Inject sets the traceparent header of h to the span of c.
+func Inject(c context.Context, h http.Header) {
+	propagator.Inject(c, propagation.HeaderCarrier(h))
+}
+
+// Context returns the context of the current span of a request, the
+// background context if there is none.
+func Context(ctx *martian.Context) context.Context {
+	if ctx != nil {
+		if c, ok := ctx.Get(contextKey); ok {
+			return c.(context.Context)
+		}
+	}
+
+	return context.Background()
+}
+
+// SetContext makes the span of c the current span of a request, the parent of
+// the spans started by the modifiers of the request.
+func SetContext(ctx *martian.Context, c context.Context) {
+	if ctx != nil {
+		ctx.Set(contextKey, c)
+	}
+}
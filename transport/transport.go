@@ -0,0 +1,236 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/imranismail/bff/config"
+)
+
+// DefaultName is the name of the transport used when none is given.
+const DefaultName = "default"
+
+var registry = struct {
+	sync.RWMutex
+	transports map[string]*http.Transport
+}{}
+
+// Config configures a transport. Unset fields keep the defaults of
+// http.DefaultTransport, Insecure and Proxy default to the global insecure and
+// url settings.
+type Config struct {
+	MaxIdleConns        int             `json:"maxIdleConns"`
+	MaxIdleConnsPerHost int             `json:"maxIdleConnsPerHost"`
+	IdleConnTimeout     config.Duration `json:"idleConnTimeout"`
+	HTTP2               *bool           `json:"http2"`
+	CABundle            string          `json:"caBundle"`
+	ClientCert          string          `json:"clientCert"`
+	ClientKey           string          `json:"clientKey"`
+	Proxy               string          `json:"proxy"`
+	Insecure            *bool           `json:"insecure"`
+}
+
+// New returns an http.Transport configured by cfg.
+func New(cfg Config) (*http.Transport, error) {
+	t := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		TLSClientConfig:       &tls.Config{},
+	}
+
+	if cfg.MaxIdleConns > 0 {
+		t.MaxIdleConns = cfg.MaxIdleConns
+	}
+
+	if cfg.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = time.Duration(cfg.IdleConnTimeout)
+	}
+
+	if cfg.HTTP2 != nil && !*cfg.HTTP2 {
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+
+	if cfg.Insecure != nil {
+		t.TLSClientConfig.InsecureSkipVerify = *cfg.Insecure
+	}
+
+	if cfg.CABundle != "" {
+		pem, err := ioutil.ReadFile(cfg.CABundle)
+
+		if err != nil {
+			return nil, fmt.Errorf("transport: caBundle: %v", err)
+		}
+
+		pool := x509.NewCertPool()
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("transport: caBundle: no certificates found in %s", cfg.CABundle)
+		}
+
+		t.TLSClientConfig.RootCAs = pool
+	}
+
+	if cfg.ClientCert != "" || cfg.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+
+		if err != nil {
+			return nil, fmt.Errorf("transport: clientCert: %v", err)
+		}
+
+		t.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if cfg.Proxy != "" {
+		proxyURL, err := url.Parse(cfg.Proxy)
+
+		if err != nil {
+			return nil, fmt.Errorf("transport: proxy: %v", err)
+		}
+
+		t.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return t, nil
+}
+
+// Registry is a set of named transports.
+type Registry struct {
+	transports map[string]*http.Transport
+}
+
+// Build returns the registry of the transports configured by configs, which
+// always includes the default transport. defaults is the base of every
+// config. The registry is not used until it is published.
+func Build(configs map[string]Config, defaults Config) (*Registry, error) {
+	named := map[string]Config{DefaultName: {}}
+
+	for name, cfg := range configs {
+		named[strings.ToLower(name)] = cfg
+	}
+
+	transports := make(map[string]*http.Transport)
+
+	for name, cfg := range named {
+		if cfg.Insecure == nil {
+			cfg.Insecure = defaults.Insecure
+		}
+
+		if cfg.Proxy == "" {
+			cfg.Proxy = defaults.Proxy
+		}
+
+		t, err := New(cfg)
+
+		if err != nil {
+			return nil, fmt.Errorf("transports.%s: %v", name, err)
+		}
+
+		transports[name] = t
+	}
+
+	return &Registry{transports: transports}, nil
+}
+
+// Has returns whether the registry has a transport named name, names are case
+// insensitive and an empty name is the default transport.
+func (r *Registry) Has(name string) bool {
+	if name == "" {
+		name = DefaultName
+	}
+
+	_, ok := r.transports[strings.ToLower(name)]
+
+	return ok
+}
+
+// Publish replaces the registered transports with the ones of r.
+func Publish(r *Registry) {
+	registry.Lock()
+	previous := registry.transports
+	registry.transports = r.transports
+	registry.Unlock()
+
+	// requests still running through the previous transports keep their
+	// connections, only the idle ones are closed
+	for _, t := range previous {
+		t.CloseIdleConnections()
+	}
+}
+
+// Stage makes r the registry transport names are checked against by Check
+// until the returned func is called, while a config is parsed before its
+// transports are published. It does not change the transports requests are
+// sent through, and stages are serialized.
+func Stage(r *Registry) func() {
+	stageMu.Lock()
+	staged.Store(r)
+
+	return func() {
+		staged.Store((*Registry)(nil))
+		stageMu.Unlock()
+	}
+}
+
+var (
+	stageMu sync.Mutex
+	staged  atomic.Value
+)
+
+// Check returns an error when name is not a transport of the staged registry,
+// or of the published one when none is staged.
+func Check(name string) error {
+	if r, _ := staged.Load().(*Registry); r != nil {
+		if !r.Has(name) {
+			return fmt.Errorf("transport: unknown transport %q", name)
+		}
+
+		return nil
+	}
+
+	_, err := Get(name)
+
+	return err
+}
+
+// Get returns the transport registered under name, names are case insensitive.
+// The default transport is returned for an empty name, http.DefaultTransport
+// when nothing has been configured.
+func Get(name string) (http.RoundTripper, error) {
+	if name == "" {
+		name = DefaultName
+	}
+
+	registry.RLock()
+	defer registry.RUnlock()
+
+	if registry.transports == nil && name == DefaultName {
+		return http.DefaultTransport, nil
+	}
+
+	t, ok := registry.transports[strings.ToLower(name)]
+
+	if !ok {
+		return nil, fmt.Errorf("transport: unknown transport %q", name)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,52 @@
+package transport
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBuildDoesNotPublish(t *testing.T) {
+	r, err := Build(map[string]Config{"Internal": {}}, Config{})
+	if err != nil {
+		t.Fatalf("Build(): got %v, want no error", err)
+	}
+
+	if !r.Has("internal") || !r.Has("") {
+		t.Errorf("r.Has(): got false, want true for internal and default")
+	}
+	if r.Has("other") {
+		t.Errorf("r.Has(%q): got true, want false", "other")
+	}
+
+	if _, err := Get("internal"); err == nil {
+		t.Error("Get(internal): got no error before Publish, want error")
+	}
+
+	unstage := Stage(r)
+
+	if err := Check("internal"); err != nil {
+		t.Errorf("Check(internal): got %v while staged, want no error", err)
+	}
+	if err := Check("other"); err == nil {
+		t.Error("Check(other): got no error while staged, want error")
+	}
+
+	unstage()
+
+	if rt, err := Get(""); err != nil || rt != http.DefaultTransport {
+		t.Errorf("Get(): got %v, %v after Stage, want http.DefaultTransport", rt, err)
+	}
+
+	Publish(r)
+	defer Publish(&Registry{})
+
+	if _, err := Get("internal"); err != nil {
+		t.Errorf("Get(internal): got %v after Publish, want no error", err)
+	}
+}
+
+func TestBuildFailure(t *testing.T) {
+	if _, err := Build(map[string]Config{"bad": {CABundle: "/does/not/exist"}}, Config{}); err == nil {
+		t.Error("Build(): got no error, want error")
+	}
+}
@@ -0,0 +1,198 @@
+// Package upstream sends the requests bff receives as an origin server to an
+// upstream server, which makes bff a reverse proxy.
+package upstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/martian/v3"
+	"github.com/google/martian/v3/log"
+	"github.com/google/martian/v3/parse"
+)
+
+const (
+	targetKey = "upstream.Target"
+	hostKey   = "upstream.Host"
+	urlKey    = "upstream.URL"
+)
+
+// Modifier picks the upstream of origin-form requests, such as the upstream
+// of a route. The request is rewritten by the Resolver once every modifier
+// has run, so the modifiers in between still see the URL bff received.
+type Modifier struct {
+	url *url.URL
+}
+
+type modifierJSON struct {
+	URL   string               `json:"url"`
+	Scope []parse.ModifierType `json:"scope"`
+}
+
+func init() {
+	parse.Register("bff.Upstream", modifierFromJSON)
+}
+
+// Parse parses an upstream url, it must be absolute.
+func Parse(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+
+	if err != nil {
+		return nil, fmt.Errorf("upstream: %v", err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("upstream: %q must be an http or https url", raw)
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("upstream: %q has no host", raw)
+	}
+
+	if u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("upstream: %q must not have a query or fragment", raw)
+	}
+
+	return u, nil
+}
+
+// NewModifier returns a Modifier sending requests to u.
+func NewModifier(u *url.URL) *Modifier {
+	log.Debugf("upstream.NewModifier: %s", u)
+
+	return &Modifier{url: u}
+}
+
+// OriginForm returns whether req was sent to bff as an origin server, with
+// only the path in its request line.
+func OriginForm(req *http.Request) bool {
+	return strings.HasPrefix(req.RequestURI, "/")
+}
+
+// ModifyRequest sets the upstream of req, replacing the one set by an earlier
+// Modifier.
+func (m *Modifier) ModifyRequest(req *http.Request) error {
+	if ctx := martian.NewContext(req); ctx != nil && OriginForm(req) {
+		log.Debugf("upstream.Modifier.ModifyRequest: %s", m.url)
+		ctx.Set(targetKey, m.url)
+	}
+
+	return nil
+}
+
+// Resolver sends origin-form requests to the upstream picked by a Modifier,
+// or to its default upstream. Absolute-form requests, sent to bff as a
+// forward proxy, are left as they are, and so are requests whose host was
+// rewritten by another modifier such as bff.URLModifier or whose round trip is
+// skipped. The response modifiers see the URL bff received again.
+type Resolver struct {
+	def *url.URL
+}
+
+// NewResolver returns a Resolver with the default upstream def, which may be
+// nil.
+func NewResolver(def *url.URL) *Resolver {
+	return &Resolver{def: def}
+}
+
+// Start returns the modifier recording the host a request was received for,
+// it runs before any Modifier.
+func (r *Resolver) Start() martian.RequestModifier {
+	return martian.RequestModifierFunc(func(req *http.Request) error {
+		if ctx := martian.NewContext(req); ctx != nil {
+			ctx.Set(hostKey, req.URL.Host)
+		}
+
+		return nil
+	})
+}
+
+// ModifyRequest rewrites the scheme, host and Host header of req to those of
+// its upstream, the path of the upstream is prepended to the request path.
+func (r *Resolver) ModifyRequest(req *http.Request) error {
+	ctx := martian.NewContext(req)
+
+	if ctx == nil || !OriginForm(req) || ctx.SkippingRoundTrip() {
+		return nil
+	}
+
+	u := r.def
+
+	if target, ok := ctx.Get(targetKey); ok {
+		u = target.(*url.URL)
+	}
+
+	if u == nil {
+		return nil
+	}
+
+	if host, ok := ctx.Get(hostKey); ok && host.(string) != req.URL.Host {
+		log.Debugf("upstream.Resolver.ModifyRequest: host rewritten to %s, skipping %s", req.URL.Host, u)
+		return nil
+	}
+
+	log.Debugf("upstream.Resolver.ModifyRequest: %s to %s", req.URL, u)
+
+	received := *req.URL
+	ctx.Set(urlKey, &received)
+
+	req.URL.Scheme = u.Scheme
+	req.URL.Host = u.Host
+	req.Host = u.Host
+
+	if base := strings.TrimSuffix(u.Path, "/"); base != "" {
+		req.URL.Path = base + req.URL.Path
+
+		if req.URL.RawPath != "" {
+			req.URL.RawPath = strings.TrimSuffix(u.EscapedPath(), "/") + req.URL.RawPath
+		}
+	}
+
+	return nil
+}
+
+// ModifyResponse restores the URL of the request of res to the one bff
+// received, so that response filters match it like request filters do.
+func (r *Resolver) ModifyResponse(res *http.Response) error {
+	ctx := martian.NewContext(res.Request)
+
+	if ctx == nil {
+		return nil
+	}
+
+	if received, ok := ctx.Get(urlKey); ok {
+		u := *received.(*url.URL)
+		res.Request.URL = &u
+		res.Request.Host = u.Host
+	}
+
+	return nil
+}
+
+// modifierFromJSON builds an upstream.Modifier from JSON.
+//
+// Example modifier JSON:
+// {
+//   "bff.Upstream": {
+//     "scope": ["request"],
+//     "url": "http://users.internal:8080/v1"
+//   }
+// }
+func modifierFromJSON(b []byte) (*parse.Result, error) {
+	msg := &modifierJSON{}
+
+	if err := json.Unmarshal(b, msg); err != nil {
+		return nil, err
+	}
+
+	u, err := Parse(msg.URL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return parse.NewResult(NewModifier(u), msg.Scope)
+}
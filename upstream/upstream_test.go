@@ -0,0 +1,127 @@
+package upstream
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/google/martian/v3"
+	"github.com/google/martian/v3/proxyutil"
+)
+
+func mustParse(t *testing.T, raw string) *url.URL {
+	t.Helper()
+
+	u, err := Parse(raw)
+	if err != nil {
+		t.Fatalf("Parse(%q): got %v, want no error", raw, err)
+	}
+
+	return u
+}
+
+func TestParse(t *testing.T) {
+	for i, raw := range []string{"http://users.internal:8080", "https://users.internal/v1/"} {
+		if _, err := Parse(raw); err != nil {
+			t.Errorf("%d. Parse(%q): got %v, want no error", i, raw, err)
+		}
+	}
+
+	for i, raw := range []string{"users.internal", "ftp://users.internal", "http:///v1", "http://users.internal?a=b", "http://users.internal#top", "http://[::1"} {
+		if _, err := Parse(raw); err == nil {
+			t.Errorf("%d. Parse(%q): got no error, want error", i, raw)
+		}
+	}
+}
+
+func TestResolver(t *testing.T) {
+	tt := []struct {
+		def        string
+		route      string
+		requestURI string
+		rewrite    string
+		skip       bool
+		want       string
+		received   string
+	}{
+		// origin-form requests go to the default upstream
+		{def: "http://default.internal", requestURI: "/users/1", want: "http://default.internal/users/1", received: "http://bff.local/users/1"},
+		// the upstream of a route wins over the default one
+		{def: "http://default.internal", route: "https://users.internal:8443", requestURI: "/users/1", want: "https://users.internal:8443/users/1", received: "http://bff.local/users/1"},
+		{route: "http://users.internal", requestURI: "/users/1", want: "http://users.internal/users/1", received: "http://bff.local/users/1"},
+		// the upstream path is prepended
+		{def: "http://default.internal/v1/", requestURI: "/users/1", want: "http://default.internal/v1/users/1", received: "http://bff.local/users/1"},
+		{def: "http://default.internal/v1", requestURI: "/users/a%2Fb", want: "http://default.internal/v1/users/a%2Fb", received: "http://bff.local/users/a%2Fb"},
+		// no upstream leaves the request as it is
+		{requestURI: "/users/1", want: "http://bff.local/users/1", received: "http://bff.local/users/1"},
+		// absolute-form requests are forward proxied
+		{def: "http://default.internal", requestURI: "http://bff.local/users/1", want: "http://bff.local/users/1", received: "http://bff.local/users/1"},
+		// a host rewritten by another modifier is kept
+		{def: "http://default.internal", requestURI: "/users/1", rewrite: "rewritten.internal", want: "http://rewritten.internal/users/1", received: "http://rewritten.internal/users/1"},
+		// a skipped round trip is not rewritten
+		{def: "http://default.internal", requestURI: "/users/1", skip: true, want: "http://bff.local/users/1", received: "http://bff.local/users/1"},
+	}
+
+	for i, tc := range tt {
+		rawURL := tc.requestURI
+		if rawURL[0] == '/' {
+			rawURL = "http://bff.local" + rawURL
+		}
+
+		req, err := http.NewRequest("GET", rawURL, nil)
+		if err != nil {
+			t.Fatalf("%d. http.NewRequest(): got %v, want no error", i, err)
+		}
+		req.RequestURI = tc.requestURI
+
+		ctx, remove, err := martian.TestContext(req, nil, nil)
+		if err != nil {
+			t.Fatalf("%d. martian.TestContext(): got %v, want no error", i, err)
+		}
+
+		var def *url.URL
+		if tc.def != "" {
+			def = mustParse(t, tc.def)
+		}
+
+		r := NewResolver(def)
+
+		if err := r.Start().ModifyRequest(req); err != nil {
+			t.Fatalf("%d. Start().ModifyRequest(): got %v, want no error", i, err)
+		}
+
+		if tc.route != "" {
+			if err := NewModifier(mustParse(t, tc.route)).ModifyRequest(req); err != nil {
+				t.Fatalf("%d. Modifier.ModifyRequest(): got %v, want no error", i, err)
+			}
+		}
+
+		if tc.rewrite != "" {
+			req.URL.Host = tc.rewrite
+		}
+
+		if tc.skip {
+			ctx.SkipRoundTrip()
+		}
+
+		if err := r.ModifyRequest(req); err != nil {
+			t.Fatalf("%d. Resolver.ModifyRequest(): got %v, want no error", i, err)
+		}
+
+		if got := req.URL.String(); got != tc.want {
+			t.Errorf("%d. req.URL: got %s, want %s", i, got, tc.want)
+		}
+
+		res := proxyutil.NewResponse(200, nil, req)
+
+		if err := r.ModifyResponse(res); err != nil {
+			t.Fatalf("%d. Resolver.ModifyResponse(): got %v, want no error", i, err)
+		}
+
+		if got := res.Request.URL.String(); got != tc.received {
+			t.Errorf("%d. res.Request.URL: got %s, want %s", i, got, tc.received)
+		}
+
+		remove()
+	}
+}